@@ -20,7 +20,9 @@ get github.com/udhos/lockfile
 get github.com/udhos/equalfile
 get gopkg.in/yaml.v2
 get golang.org/x/crypto/ssh
+get github.com/pkg/sftp
 get github.com/aws/aws-sdk-go
+get github.com/klauspost/compress/zstd
 #get honnef.co/go/simple/cmd/gosimple
 #get honnef.co/go/tools/cmd/staticcheck
 
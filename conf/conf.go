@@ -24,6 +24,43 @@ type AppConfig struct {
 	MaxConfigLoadSize int64
 	LastChange        Change
 	Comment           string // free user-defined field
+
+	JumpHosts []JumpHost // ssh bastions for reaching devices
+
+	Proxy string // default proxy for devices: "socks5://[user:pass@]host:port" or "http://[user:pass@]host:port" - "" means direct connection
+
+	Filters []LineFilter // user-defined line filters - devices refer to a filter by name in LineFilter attribute
+
+	Compression string // compression for new backup files: "gzip", "zstd" or "" for none - files are decompressed transparently regardless of this setting
+}
+
+// LineFilter is a user-defined line filter.
+// Rules are applied in order to every saved line.
+type LineFilter struct {
+	Name  string
+	Rules []FilterRule
+}
+
+// FilterRule is a rule for user-defined line filter.
+type FilterRule struct {
+	Action  string // "drop": drop matching line - "replace": replace Pattern matches with Replace - "dropblock": drop lines from Pattern match through End match
+	Pattern string // regexp matching line
+	Replace string // replacement template for "replace" - $1 expands to first submatch
+	End     string // regexp matching last line of block for "dropblock"
+}
+
+// JumpHost is an ssh bastion for reaching devices.
+// Devices refer to a jump host by name.
+type JumpHost struct {
+	Name             string
+	HostPort         string
+	User             string
+	Password         string
+	SSHAuth          string   // ssh auth methods in order: "publickey,agent,password,keyboard-interactive"
+	SSHKeyPaths      []string // private key files for ssh publickey auth
+	SSHKeyPassphrase string   // passphrase for encrypted private keys
+	SSHAgentSocket   string   // ssh-agent socket for ssh agent auth: "$SSH_AUTH_SOCK"
+	HostKeyCheck     string   // ssh host key verification: "tofu" (default) or "strict"
 }
 
 // NewAppConfigFromString creates AppConfig from string.
@@ -72,6 +109,7 @@ type DevAttributes struct {
 	QuoteSentCommandsFormat      string        // !![%s] - empty means omitting
 	KeepControlChars             bool          // enable if you want to capture control chars (backspace, etc)
 	LineFilter                   string        // line filter name - applied to every saved line
+	LineFilters                  []string      // more line filters - applied in order after LineFilter
 	ChangesOnly                  bool          // save new file only if it differs from previous one
 	S3ContentType                string        // ""=none "detect"=http.Detect "text/plain" etc
 	RunProg                      []string      // "/path/to/external/command", "arg1", "arg2" for the run model
@@ -80,6 +118,9 @@ type DevAttributes struct {
 	PostLoginPromptPattern       string        // mikrotik: Please press "Enter" to continue!
 	PostLoginPromptResponse      string        // mikrotik: \r\n
 	UsernameAppend               string        // mikrotik: +cte
+	HostKeyCheck                 string        // ssh host key verification: "tofu" (default) or "strict"
+	MaskSecrets                  bool          // replace passwords, keys and communities in saved lines with stable hashes
+	MaskRules                    string        // secret masking rule set selected by model: "cisco", "junos", "fortios", "huawei" - used only when MaskSecrets is enabled
 
 	// readTimeout: per-read timeout (protection against inactivity)
 	// matchTimeout: full match timeout (protection against slow sender -- think 1 byte per second)
@@ -88,6 +129,61 @@ type DevAttributes struct {
 	SendTimeout         time.Duration // protection against inactivity
 	CommandReadTimeout  time.Duration // larger timeout for slow responses (slow show running)
 	CommandMatchTimeout time.Duration // larger timeout for slow responses (slow show running)
+
+	// rest model: HTTP(S) API retrieval
+	URLList                []string          // "/api/config" (relative to device hostport) or full "https://host/api/config" - replaces CommandList
+	HTTPScheme             string            // scheme for relative URLs: "http" or "https" - transports "http" or "https" take precedence
+	HTTPAuth               string            // "basic" (default), "bearer" (password is the token) or "none"
+	HTTPHeaders            map[string]string // extra request headers: "Accept": "application/yang-data+json"
+	HTTPClientCert         string            // client certificate file (PEM)
+	HTTPClientKey          string            // client private key file (PEM)
+	HTTPCACert             string            // CA certificates file (PEM) for server verification - "" means system roots
+	HTTPInsecureSkipVerify bool              // skip server certificate verification
+	HTTPPrettyJSON         bool              // indent JSON responses
+
+	// files model: remote files retrieval
+	FileList []string // remote files copied thru transports "sftp" and/or "scp" - replaces CommandList
+
+	// cisco-asa model: multiple context mode
+	ContextList []string // contexts visited with "changeto context" for running CommandList - "*" means all contexts from "show context"
+
+	// dialog script: replaces login, enable, pager off and command list
+	Dialog []DialogStep
+
+	// separate files per command
+	Artifacts []Artifact // commands saved into their own files instead of main file
+}
+
+// Artifact is a file saved apart from device main file.
+// Files are named as <device>.<artifact>.<commit>
+type Artifact struct {
+	Name        string   // artifact name: "version"
+	Commands    []string // commands whose outputs are saved into this artifact: "show version"
+	LineFilters []string // filter chain for this artifact - empty means device filter chain
+	ChangesOnly bool     // save new file only if it differs from previous one
+}
+
+// DialogStep is one step of an expect-style dialog script.
+// Send is sent first (if not empty), then the step waits for any pattern in Expect (if not empty).
+// Send strings may refer to secrets: {{username}}, {{password}} and {{enable}}.
+type DialogStep struct {
+	Label     string         // target for Goto
+	Send      string         // text to send
+	NoLF      bool           // do not append LF to Send
+	Save      bool           // save output as result of command Send
+	Expect    []DialogBranch // patterns to wait for - first match wins
+	Timeout   time.Duration  // match timeout for this step - 0 means default
+	OnTimeout string         // label to go on match timeout - "" means failure
+}
+
+// DialogBranch is taken when Pattern matches.
+// Goto: "" means next step, "end" finishes the dialog successfully, "fail" aborts the dialog.
+type DialogBranch struct {
+	Pattern  string // regexp - "" means EOF
+	Send     string // reply sent when matched
+	NoLF     bool   // do not append LF to Send
+	Continue bool   // keep waiting in the same step after reply (like exp_continue)
+	Goto     string // label of next step
 }
 
 // DevConfig is full set of device properties.
@@ -104,6 +200,15 @@ type DevConfig struct {
 	Comment        string // free user-defined field
 	LastChange     Change
 	Attr           DevAttributes
+
+	SSHAuth          string   // ssh auth methods in order: "publickey,agent,password,keyboard-interactive"
+	SSHKeyPaths      []string // private key files for ssh publickey auth
+	SSHKeyPassphrase string   // passphrase for encrypted private keys
+	SSHAgentSocket   string   // ssh-agent socket for ssh agent auth: "$SSH_AUTH_SOCK"
+
+	JumpHost string // name of ssh bastion from global JumpHosts - "" means direct connection
+
+	Proxy string // proxy URL overriding global Proxy - "none" disables global Proxy
 }
 
 // NewDeviceFromString creates device configuration from string.
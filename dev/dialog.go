@@ -0,0 +1,240 @@
+package dev
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+// Special labels for DialogBranch.Goto and DialogStep.OnTimeout.
+const (
+	dialogEnd  = "end"  // finish dialog successfully
+	dialogFail = "fail" // abort dialog
+)
+
+const dialogMaxSteps = 1000 // protection against endless loops
+
+// validateDialog checks a dialog script and returns its labels.
+func validateDialog(steps []conf.DialogStep) (map[string]int, error) {
+	labels := map[string]int{}
+	for i, s := range steps {
+		if s.Label == "" {
+			continue
+		}
+		if s.Label == dialogEnd || s.Label == dialogFail {
+			return nil, fmt.Errorf("dialog step %d: reserved label: '%s'", i, s.Label)
+		}
+		if _, found := labels[s.Label]; found {
+			return nil, fmt.Errorf("dialog step %d: duplicate label: '%s'", i, s.Label)
+		}
+		labels[s.Label] = i
+	}
+
+	target := func(label string) bool {
+		if label == "" || label == dialogEnd || label == dialogFail {
+			return true
+		}
+		_, found := labels[label]
+		return found
+	}
+
+	for i, s := range steps {
+		if !target(s.OnTimeout) {
+			return nil, fmt.Errorf("dialog step %d: unknown ontimeout label: '%s'", i, s.OnTimeout)
+		}
+		if s.Timeout < 0 {
+			return nil, fmt.Errorf("dialog step %d: negative timeout: %s", i, s.Timeout)
+		}
+		for j, b := range s.Expect {
+			if _, err := regexp.Compile(b.Pattern); err != nil {
+				return nil, fmt.Errorf("dialog step %d branch %d: bad pattern: %v", i, j, err)
+			}
+			if !target(b.Goto) {
+				return nil, fmt.Errorf("dialog step %d branch %d: unknown goto label: '%s'", i, j, b.Goto)
+			}
+			if b.Continue && b.Goto != "" {
+				return nil, fmt.Errorf("dialog step %d branch %d: continue conflicts with goto", i, j)
+			}
+			if b.Continue && b.Pattern == "" {
+				return nil, fmt.Errorf("dialog step %d branch %d: can't continue after EOF", i, j)
+			}
+		}
+	}
+
+	return labels, nil
+}
+
+// runDialog executes the dialog script from device attributes.
+func (d *Device) runDialog(logger hasPrintf, t transp, capture *dialog) error {
+
+	steps := d.Attr.Dialog
+
+	labels, validateErr := validateDialog(steps)
+	if validateErr != nil {
+		return fmt.Errorf("runDialog: %v", validateErr)
+	}
+
+	// save timeouts
+	saveReadTimeout := d.Attr.ReadTimeout
+	saveMatchTimeout := d.Attr.MatchTimeout
+
+	// restore timeouts
+	defer func() {
+		d.Attr.ReadTimeout = saveReadTimeout
+		d.Attr.MatchTimeout = saveMatchTimeout
+	}()
+
+	count := 0
+
+	for i := 0; i < len(steps); {
+		count++
+		if count > dialogMaxSteps {
+			return fmt.Errorf("runDialog: too many steps: %d", count)
+		}
+
+		s := &steps[i]
+
+		// steps saving output are commands: use larger timeouts
+		if s.Save {
+			d.Attr.ReadTimeout = d.Attr.CommandReadTimeout
+			d.Attr.MatchTimeout = d.Attr.CommandMatchTimeout
+		} else {
+			d.Attr.ReadTimeout = saveReadTimeout
+			d.Attr.MatchTimeout = saveMatchTimeout
+		}
+		if s.Timeout > 0 {
+			d.Attr.MatchTimeout = s.Timeout
+			if d.Attr.ReadTimeout > s.Timeout {
+				d.Attr.ReadTimeout = s.Timeout
+			}
+		}
+
+		d.debugf("runDialog: step %d label=[%s] send=[%q]", i, s.Label, s.Send)
+
+		next, stepErr := d.dialogStep(logger, t, capture, s)
+		if stepErr != nil {
+			return fmt.Errorf("runDialog: step %d: %v", i, stepErr)
+		}
+
+		switch next {
+		case "":
+			i++
+		case dialogEnd:
+			return nil
+		case dialogFail:
+			return fmt.Errorf("runDialog: step %d: failed", i)
+		default:
+			i = labels[next]
+		}
+	}
+
+	return nil
+}
+
+// dialogStep runs a single step and returns the label of next step.
+func (d *Device) dialogStep(logger hasPrintf, t transp, capture *dialog, s *conf.DialogStep) (string, error) {
+
+	if s.Send != "" {
+		if sendErr := d.dialogSend(logger, t, s.Send, s.NoLF); sendErr != nil {
+			return "", fmt.Errorf("could not send '%s': %v", s.Send, sendErr)
+		}
+	}
+
+	if len(s.Expect) < 1 {
+		return "", nil
+	}
+
+	// empty pattern matches EOF
+	var patterns []string
+	var branches []int // pattern index => branch index
+	eofBranch := -1
+	for j, b := range s.Expect {
+		if b.Pattern == "" {
+			if eofBranch < 0 {
+				eofBranch = j
+			}
+			continue
+		}
+		patterns = append(patterns, b.Pattern)
+		branches = append(branches, j)
+	}
+	if len(patterns) < 1 {
+		patterns = []string{""} // look for EOF only
+	}
+
+	var output []byte
+
+	for n := 0; n < dialogMaxSteps; n++ {
+		m, buf, matchErr := d.match(logger, t, capture, patterns)
+
+		output = append(output, buf...)
+
+		var branch int
+
+		switch {
+		case matchErr == nil:
+			branch = branches[m]
+		case matchErr == io.EOF && eofBranch >= 0:
+			branch = eofBranch
+		default:
+			if _, isTimeout := matchErr.(matchTimeoutError); isTimeout && s.OnTimeout != "" {
+				d.debugf("dialogStep: %v - going to '%s'", matchErr, s.OnTimeout)
+				return s.OnTimeout, nil
+			}
+			return "", fmt.Errorf("could not match: %v buf=[%s]", matchErr, buf)
+		}
+
+		b := &s.Expect[branch]
+
+		d.debugf("dialogStep: matched branch %d pattern=[%s]", branch, b.Pattern)
+
+		if b.Send != "" {
+			if sendErr := d.dialogSend(logger, t, b.Send, b.NoLF); sendErr != nil {
+				return "", fmt.Errorf("could not send reply '%s': %v", b.Send, sendErr)
+			}
+		}
+
+		if b.Continue {
+			continue
+		}
+
+		if s.Save {
+			if saveErr := d.save(logger, capture, s.Send, output); saveErr != nil {
+				return "", fmt.Errorf("could not save command '%s' result: %v", s.Send, saveErr)
+			}
+		}
+
+		return b.Goto, nil
+	}
+
+	return "", fmt.Errorf("too many matches: %d", dialogMaxSteps)
+}
+
+// dialogSend sends msg after replacing secrets.
+// Only the unexpanded msg is recorded into saved output and error messages.
+func (d *Device) dialogSend(logger hasPrintf, t transp, msg string, noLF bool) error {
+	r := strings.NewReplacer("{{username}}", d.Username(), "{{password}}", d.LoginPassword, "{{enable}}", d.EnablePassword)
+	expanded := r.Replace(msg)
+
+	var err error
+	if noLF {
+		err = d.send(logger, t, expanded)
+	} else {
+		err = d.sendln(logger, t, expanded)
+	}
+	if err == nil {
+		return nil
+	}
+
+	// write errors might quote the expanded message: put templates back in place of secrets
+	var hide []string
+	for _, s := range []struct{ secret, template string }{{d.LoginPassword, "{{password}}"}, {d.EnablePassword, "{{enable}}"}} {
+		if s.secret != "" {
+			hide = append(hide, s.secret, s.template)
+		}
+	}
+	return fmt.Errorf("dialogSend: %s", strings.NewReplacer(hide...).Replace(err.Error()))
+}
@@ -0,0 +1,247 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestDialog(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerDialog(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus dialog server: %v", listenErr)
+	}
+
+	prompt := `\S+>\s*$`
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "cisco-ios", "lab1", "localhost"+addr, "telnet", "lab", "secret", "", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	d.Attr.Dialog = []conf.DialogStep{
+		{Expect: []conf.DialogBranch{
+			{Pattern: `Press any key`, Send: " ", NoLF: true, Continue: true},
+			{Pattern: `Username:\s*$`, Send: "{{username}}", Continue: true},
+			{Pattern: `Password:\s*$`, Send: "{{password}}", Continue: true},
+			{Pattern: `Choice:\s*$`, Send: "1"},
+		}},
+		{Expect: []conf.DialogBranch{{Pattern: prompt}}},
+		{Send: "show config", Save: true, Expect: []conf.DialogBranch{
+			{Pattern: `--More--`, Send: " ", NoLF: true, Continue: true},
+			{Pattern: prompt},
+		}},
+		{Send: "save", Expect: []conf.DialogBranch{
+			{Pattern: `\(y/n\)`, Send: "y", Continue: true},
+			{Pattern: prompt},
+		}},
+		{Expect: []conf.DialogBranch{{Pattern: `never sent`}}, Timeout: 300 * time.Millisecond, OnTimeout: "bye"},
+		{Send: "reload", Expect: []conf.DialogBranch{{Pattern: `.`, Goto: "fail"}}},
+		{Label: "bye", Send: "exit", Expect: []conf.DialogBranch{{Pattern: ""}}},
+	}
+	tab.UpdateDevice(d)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{`!!["show config"]`, "config line 1", "config line 2"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"secret", "saved"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func TestDialogValidate(t *testing.T) {
+	bad := [][]conf.DialogStep{
+		{{Label: "a"}, {Label: "a"}},
+		{{Label: dialogEnd}},
+		{{OnTimeout: "missing"}},
+		{{Expect: []conf.DialogBranch{{Pattern: "("}}}},
+		{{Expect: []conf.DialogBranch{{Pattern: "x", Goto: "missing"}}}},
+		{{Label: "a", Expect: []conf.DialogBranch{{Pattern: "x", Goto: "a", Continue: true}}}},
+		{{Expect: []conf.DialogBranch{{Pattern: "", Continue: true}}}},
+	}
+	for i, steps := range bad {
+		if _, err := validateDialog(steps); err == nil {
+			t.Errorf("validateDialog: %d: expected error: %v", i, steps)
+		}
+	}
+
+	good := []conf.DialogStep{
+		{Label: "a", Expect: []conf.DialogBranch{{Pattern: "x", Goto: "b"}, {Pattern: "y", Goto: dialogEnd}}},
+		{Label: "b", OnTimeout: "a", Expect: []conf.DialogBranch{{Pattern: ""}}},
+	}
+	if _, err := validateDialog(good); err != nil {
+		t.Errorf("validateDialog: unexpected error: %v", err)
+	}
+}
+
+func spawnServerDialog(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopDialog(t, s, handleConnectionDialog)
+
+	return s, nil
+}
+
+func acceptLoopDialog(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopDialog: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+// handleConnectionDialog: bogus server with banner, menu, pager and confirmation
+func handleConnectionDialog(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	chat := func(send, expect string) bool {
+		if _, err := c.Write([]byte(send)); err != nil {
+			t.Logf("handleConnectionDialog: send %q: %v", send, err)
+			return false
+		}
+		n, err := c.Read(buf)
+		if err != nil {
+			t.Logf("handleConnectionDialog: read: %v", err)
+			return false
+		}
+		if !strings.Contains(string(buf[:n]), expect) {
+			t.Errorf("handleConnectionDialog: expected=%q got=%q", expect, buf[:n])
+			return false
+		}
+		return true
+	}
+
+	if !chat("Welcome\nPress any key to continue", " ") ||
+		!chat("\nUsername: ", "lab") ||
+		!chat("\nPassword: ", "secret") ||
+		!chat("\n1) CLI\n2) Exit\nChoice: ", "1") {
+		return
+	}
+
+	prompt := "\nsw> "
+
+	for {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionDialog: send prompt: %v", err)
+			return
+		}
+
+		n, err := c.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				t.Logf("handleConnectionDialog: read command: %v", err)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		switch cmd {
+		case "show config":
+			if !chat("\nconfig line 1\n--More--", " ") {
+				return
+			}
+			fmt.Fprint(c, "\nconfig line 2")
+		case "save":
+			if !chat("\nAre you sure? (y/n) ", "y") {
+				return
+			}
+			fmt.Fprint(c, "\nsaved")
+		case "exit":
+			return
+		default:
+			t.Errorf("handleConnectionDialog: unexpected command: %q", cmd)
+			return
+		}
+	}
+}
+
+// brokenTransp fails writes quoting the message, like transpSSH.
+type brokenTransp struct{}
+
+func (brokenTransp) Read(b []byte) (int, error) { return 0, io.EOF }
+func (brokenTransp) Write(b []byte) (int, error) {
+	return -1, fmt.Errorf("ssh write(%s): broken pipe", b)
+}
+func (brokenTransp) SetDeadline(t time.Time) error      { return nil }
+func (brokenTransp) SetWriteDeadline(t time.Time) error { return nil }
+func (brokenTransp) Close() error                       { return nil }
+
+func TestDialogSendHidesSecrets(t *testing.T) {
+	logger := &testLogger{t}
+	d := &Device{logger: logger}
+	d.LoginUser = "lab"
+	d.LoginPassword = "pass123"
+	d.EnablePassword = "en456"
+
+	for _, c := range []struct{ msg, template string }{{"{{password}}", "{{password}}"}, {"{{enable}}", "{{enable}}"}, {"{{username}} {{password}}", "lab {{password}}"}} {
+		msg := c.msg
+		err := d.dialogSend(logger, brokenTransp{}, msg, false)
+		if err == nil {
+			t.Fatalf("dialogSend %q: expected error", msg)
+		}
+		if strings.Contains(err.Error(), "pass123") || strings.Contains(err.Error(), "en456") {
+			t.Errorf("dialogSend %q: secret in error: %v", msg, err)
+		}
+		if !strings.Contains(err.Error(), c.template) {
+			t.Errorf("dialogSend %q: template missing from error: %v", msg, err)
+		}
+	}
+}
@@ -1,26 +1,36 @@
 package dev
 
 import (
+	"bytes"
 	"regexp"
+	"sort"
 	"strconv"
+	"sync"
 )
 
 // FilterTable stores line filters for custom line-by-line processing of configuration.
 type FilterTable struct {
-	table map[string]FilterFunc
+	table map[string]MultiLineFunc
 	re1   *regexp.Regexp
 	re2   *regexp.Regexp
 	re3   *regexp.Regexp
 	re4   *regexp.Regexp
+
+	user     map[string]*userFilter // user-defined filters from app config
+	userLock sync.RWMutex
 }
 
 // FilterFunc is a helper function type for line filters.
 type FilterFunc func(hasPrintf, bool, *FilterTable, []byte, int) []byte
 
+// MultiLineFunc is a filter processing all saved lines at once.
+// It can keep state across lines, drop blocks, insert or reorder lines.
+type MultiLineFunc func(hasPrintf, bool, *FilterTable, [][]byte) [][]byte
+
 // NewFilterTable creates a filter table.
 func NewFilterTable(logger hasPrintf) *FilterTable {
 	t := &FilterTable{
-		table: map[string]FilterFunc{},
+		table: map[string]MultiLineFunc{},
 		re1:   regexp.MustCompile(`^\w{3}\s\w{3}\s\d{1,2}\s`), // Thu Feb 11 15:45:43.545 BRST
 		re2:   regexp.MustCompile(`^Building`),                // Building configuration...
 		re3:   regexp.MustCompile(`^!! Last`),                 // !! Last configuration change at Tue Jan 26 16:40:46 2016 by user
@@ -30,16 +40,162 @@ func NewFilterTable(logger hasPrintf) *FilterTable {
 	return t
 }
 
-func register(logger hasPrintf, table map[string]FilterFunc, name string, f FilterFunc) {
+func register(logger hasPrintf, table map[string]MultiLineFunc, name string, f FilterFunc) {
+	registerMultiLine(logger, table, name, lineByLine(f))
+}
+
+func registerMultiLine(logger hasPrintf, table map[string]MultiLineFunc, name string, f MultiLineFunc) {
 	logger.Printf("line filter registered: '%s'", name)
 	table[name] = f
 }
 
-func registerFilters(logger hasPrintf, table map[string]FilterFunc) {
+func registerFilters(logger hasPrintf, table map[string]MultiLineFunc) {
 	register(logger, table, "iosxr", filterIOSXR)
 	register(logger, table, "noop", filterNoop)
 	register(logger, table, "drop", filterDrop)
 	register(logger, table, "count_lines", filterCountLines)
+	registerMultiLine(logger, table, "drop_empty", filterDropEmpty)
+	registerMultiLine(logger, table, "sort_sections", filterSortSections)
+
+	var sets []string
+	for set := range maskRules {
+		sets = append(sets, set)
+	}
+	sort.Strings(sets)
+	for _, set := range sets {
+		register(logger, table, "mask_secrets_"+set, filterMaskSecrets(maskRules[set]))
+	}
+
+	var names []string
+	for name := range volatileLines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		register(logger, table, name, filterVolatile(name, volatileLines[name]))
+	}
+}
+
+// volatileLines lists per-model patterns for lines that change on every fetch (timestamps, uptime, counters).
+// Each entry is registered as a line filter named after the model, and used as the model default LineFilter.
+// Dropping volatile lines keeps ChangesOnly from saving a new file on every fetch.
+var volatileLines = map[string][]string{
+	"arista-eos": {
+		`^Uptime:`,      // Uptime: 5 weeks, 2 days, 3 hours and 12 minutes
+		`^Free memory:`, // Free memory: 5624316 kB
+		`^! Time:`,      // ! Time: Thu Feb 11 15:45:43 2016
+	},
+	"cisco-apic": {
+		`^# Time:`, // # Time: Thu Feb 11 15:45:43 2016
+	},
+	"aruba-cx": {
+		`^Current configuration:`, // Current configuration:
+		`^\s*Up Time\s*: `,        // Up Time                 : 3 days 2 hours 5 minutes
+	},
+	"cisco-asa": {
+		`^Cryptochecksum:`, // Cryptochecksum:8f2c4e0a 1d6b7f3e 9a0c2b44 5e7d1f60
+		`^: Written by `,   // : Written by enable_15 at 15:45:43.545 BRST Thu Feb 11 2016
+		`^\S+ up \d+ `,     // asa up 10 days 2 hours
+	},
+	"cisco-ios": {
+		`^ntp clock-period `,                     // ntp clock-period 17179865
+		`^! Last configuration change at `,       // ! Last configuration change at 16:40:46 BRST Tue Jan 26 2016 by user
+		`^! NVRAM config last updated at `,       // ! NVRAM config last updated at 16:40:46 BRST Tue Jan 26 2016 by user
+		`^\S+ uptime is `,                        // router uptime is 9 years, 2 weeks, 5 days, 20 hours, 3 minutes
+		`^Uptime for this control processor is `, // Uptime for this control processor is 9 years, 2 weeks
+		`^System restarted at `,                  // System restarted at 16:40:46 BRST Tue Jan 26 2016
+	},
+	"cisco-nga": {
+		`(?i)^\s*(system )?uptime`, // System uptime: 12 days, 3 hours, 4 minutes
+	},
+	"cisco-nxos": {
+		`^!Time:`,                  // !Time: Thu Feb 11 15:45:43 2016
+		`^!Running configuration `, // !Running configuration last done at: Thu Feb 11 15:45:43 2016
+		`^Kernel uptime is `,       // Kernel uptime is 12 day(s), 3 hour(s), 4 minute(s), 5 second(s)
+	},
+	"dmswitch": {
+		`(?i)^\s*(system )?uptime`,    // Uptime: 12 days, 03:04:05
+		`(?i)^\s*current (date|time)`, // Current time: 2016-02-11 15:45:43
+	},
+	"f5-bigip": {
+		`^Last login: `, // Last login: Thu Feb 11 15:45:43 2016 from 10.0.0.1
+		`^\s+last-(update|sync)-time \d{4}-\d\d-`, //     last-update-time 2016-02-11:15:45:43
+	},
+	"fortios": {
+		`^#conf_file_ver=`,  // #conf_file_ver=8740134532164231
+		`^System time: `,    // System time: Thu Feb 11 15:45:43 2016
+		`^Uptime: `,         // Uptime: 12 days,  3 hours,  4 minutes
+		`^[\w -]+DB: \d`,    // Virus-DB: 76.00656(2020-04-21 11:20) - updated signatures
+		`^Cluster uptime: `, // Cluster uptime: 12 days, 3 hours, 4 minutes, 5 seconds
+	},
+	"hpe-comware": {
+		` uptime is \d+ weeks?,`, // HPE 5130 24G 4SFP+ EI Switch uptime is 0 weeks, 0 days, 2 hours, 25 minutes
+	},
+	"huawei-vrp": {
+		`^!Last configuration was (updated|saved) at `, // !Last configuration was updated at 2017-01-02 12:34:56+00:00 by user
+		` uptime is \d+ weeks?,`,                       // HUAWEI S5700-28C-EI Routing Switch uptime is 0 week, 3 days, 2 hours, 4 minutes
+	},
+	"junos": {
+		`^## Last commit: `,  // ## Last commit: 2017-01-02 12:34:56 UTC by user
+		`^## Last changed: `, // ## Last changed: 2017-01-02 12:34:56 UTC
+	},
+	"linux": {
+		`^\s*\d\d:\d\d:\d\d up `, //  15:45:43 up 3 days,  2:05,  1 user,  load average: 0.00, 0.01, 0.05
+	},
+	"mikrotik": {
+		`^# \w{3}/\d\d/\d{4} \d\d:\d\d:\d\d by RouterOS`,                                              // # jan/02/2017 12:34:56 by RouterOS 6.38.1
+		`^\s*(uptime|cpu-load|free-memory|free-hdd-space|write-sect-since-reboot|write-sect-total): `, // uptime: 3d2h45m
+	},
+	"nokia-sros": {
+		`^# (Generated|Finished) `, // # Generated THU FEB 11 15:45:43 2016 UTC
+	},
+	"paloalto-panos": {
+		`^Last login: `,      // Last login: Thu Feb 11 15:45:43 2016 from 10.0.0.1
+		`^Number of failed `, // Number of failed attempts since last successful login: 0
+		`^#\["set cli config-output-format set"\]$`, // setup command: quoted by QuoteSentCommandsFormat, no output
+	},
+	"vyos": {
+		`^Uptime:`, // Uptime:      15:45:43 up 3 days,  2:05,  1 user,  load average: 0.00, 0.01, 0.05
+	},
+}
+
+// filterVolatile creates a line filter dropping lines matched by any pattern.
+func filterVolatile(name string, patterns []string) FilterFunc {
+	list := make([]*regexp.Regexp, len(patterns))
+	for i, p := range patterns {
+		list[i] = regexp.MustCompile(p)
+	}
+
+	return func(logger hasPrintf, debug bool, table *FilterTable, line []byte, lineNum int) []byte {
+		for _, re := range list {
+			if re.Match(line) {
+				if debug {
+					logger.Printf("filterVolatile: %s: drop: [%s]", name, string(line))
+				}
+				return []byte{}
+			}
+		}
+		return line
+	}
+}
+
+// lineByLine adapts a single line filter to process all lines.
+// Lines dropped by the line filter are kept as empty lines.
+func lineByLine(f FilterFunc) MultiLineFunc {
+	return func(logger hasPrintf, debug bool, table *FilterTable, lines [][]byte) [][]byte {
+		for i, line := range lines {
+			lines[i] = f(logger, debug, table, line, i+1)
+		}
+		return lines
+	}
+}
+
+// applyFilters runs lines thru filter chain.
+func applyFilters(logger hasPrintf, debug bool, table *FilterTable, chain []MultiLineFunc, lines [][]byte) [][]byte {
+	for _, f := range chain {
+		lines = f(logger, debug, table, lines)
+	}
+	return lines
 }
 
 func filterDrop(logger hasPrintf, debug bool, table *FilterTable, line []byte, lineNum int) []byte {
@@ -50,6 +206,64 @@ func filterNoop(logger hasPrintf, debug bool, table *FilterTable, line []byte, l
 	return line
 }
 
+// filterMaskSecrets builds a line filter masking secrets found by rules.
+func filterMaskSecrets(rules []*regexp.Regexp) FilterFunc {
+	return func(logger hasPrintf, debug bool, table *FilterTable, line []byte, lineNum int) []byte {
+		return maskSecrets(rules, line)
+	}
+}
+
+// filterDropEmpty removes empty lines, including lines emptied by previous filters.
+func filterDropEmpty(logger hasPrintf, debug bool, table *FilterTable, lines [][]byte) [][]byte {
+	result := lines[:0]
+	for _, line := range lines {
+		if len(bytes.TrimSpace(line)) > 0 {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// filterSortSections reorders top-level sections by their first line.
+// A section is a non-indented line followed by its indented lines.
+// Single top-level lines, like numbered access-list entries or end, keep their position, since their order matters.
+// Useful for devices that output sections in varying order.
+func filterSortSections(logger hasPrintf, debug bool, table *FilterTable, lines [][]byte) [][]byte {
+	var sections [][][]byte
+	for _, line := range lines {
+		if len(sections) > 0 && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+			last := len(sections) - 1
+			sections[last] = append(sections[last], line) // continue section
+			continue
+		}
+		sections = append(sections, [][]byte{line}) // new section
+	}
+
+	// sort sections with indented lines among their own positions
+	var slots []int
+	var blocks [][][]byte
+	for i, s := range sections {
+		if len(s) > 1 {
+			slots = append(slots, i)
+			blocks = append(blocks, s)
+		}
+	}
+
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return bytes.Compare(blocks[i][0], blocks[j][0]) < 0
+	})
+
+	for i, slot := range slots {
+		sections[slot] = blocks[i]
+	}
+
+	result := make([][]byte, 0, len(lines))
+	for _, s := range sections {
+		result = append(result, s...)
+	}
+	return result
+}
+
 func filterCountLines(logger hasPrintf, debug bool, table *FilterTable, line []byte, lineNum int) []byte {
 	line = append([]byte(strconv.Itoa(lineNum)+": "), line...)
 	return line
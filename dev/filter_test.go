@@ -0,0 +1,220 @@
+package dev
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestFilterVolatile(t *testing.T) {
+
+	logger := &testLogger{t}
+	ft := NewFilterTable(logger)
+
+	cases := []struct {
+		filter string
+		line   string
+		drop   bool
+	}{
+		{"cisco-ios", "ntp clock-period 17179865", true},
+		{"cisco-ios", "! Last configuration change at 16:40:46 BRST Tue Jan 26 2016 by user", true},
+		{"cisco-ios", "router uptime is 9 years, 2 weeks, 5 days, 20 hours, 3 minutes", true},
+		{"cisco-ios", "ntp server 10.0.0.1", false},
+		{"cisco-ios", " description uptime is critical", false},
+		{"junos", "## Last commit: 2017-01-02 12:34:56 UTC by user", true},
+		{"junos", "set system host-name lab1", false},
+		{"fortios", "#conf_file_ver=8740134532164231", true},
+		{"fortios", "Virus-DB: 76.00656(2020-04-21 11:20)", true},
+		{"fortios", "    set hostname \"fw1\"", false},
+		{"huawei-vrp", "!Last configuration was updated at 2017-01-02 12:34:56+00:00 by user", true},
+		{"huawei-vrp", "HUAWEI S5700-28C-EI Routing Switch uptime is 0 week, 3 days, 2 hours, 4 minutes", true},
+		{"huawei-vrp", " sysname lab1", false},
+		{"mikrotik", "# jan/02/2017 12:34:56 by RouterOS 6.38.1", true},
+		{"mikrotik", "                   uptime: 3d2h45m", true},
+		{"mikrotik", "/system identity", false},
+		{"linux", " 15:45:43 up 3 days,  2:05,  1 user,  load average: 0.00, 0.01, 0.05", true},
+		{"arista-eos", "Uptime:                 5 weeks, 2 days, 3 hours and 12 minutes", true},
+		{"cisco-asa", "Cryptochecksum:8f2c4e0a 1d6b7f3e 9a0c2b44 5e7d1f60", true},
+		{"cisco-nxos", "!Time: Thu Feb 11 15:45:43 2016", true},
+		{"nokia-sros", "# Finished THU FEB 11 15:45:44 2016 UTC", true},
+		{"aruba-cx", "Current configuration:", true},
+		{"aruba-cx", "Up Time                 : 3 days 2 hours 5 minutes", true},
+		{"aruba-cx", "hostname switch", false},
+		{"paloalto-panos", `#["set cli config-output-format set"]`, true},
+		{"paloalto-panos", `#["show config running"]`, false},
+		{"f5-bigip", "    last-update-time 2016-02-11:15:45:43", true},
+		{"f5-bigip", "    revision 1", false},
+		{"f5-bigip", "    expiration-time 2026-02-11:15:45:43", false},
+	}
+
+	for _, c := range cases {
+		f, found := ft.table[c.filter]
+		if !found {
+			t.Errorf("filter not found: %s", c.filter)
+			continue
+		}
+		out := f(logger, false, ft, [][]byte{[]byte(c.line)})
+		if dropped := len(out[0]) == 0; dropped != c.drop {
+			t.Errorf("filter %s: line=[%s] expected drop=%v got=%v", c.filter, c.line, c.drop, dropped)
+		}
+	}
+
+	// every model with volatile lines must use its filter by default
+	tab := NewDeviceTable()
+	RegisterModels(logger, tab)
+	for name := range volatileLines {
+		m, err := tab.GetModel(name)
+		if err != nil {
+			continue // filter shared by another model
+		}
+		if m.defaultAttr.LineFilter != name {
+			t.Errorf("model %s: default LineFilter=[%s]", name, m.defaultAttr.LineFilter)
+		}
+	}
+}
+
+func TestUserFilters(t *testing.T) {
+
+	logger := &testLogger{t}
+	ft := NewFilterTable(logger)
+
+	filters := []conf.LineFilter{
+		{Name: "site", Rules: []conf.FilterRule{
+			{Action: "drop", Pattern: `^! Time:`},
+			{Action: "replace", Pattern: `(secret \d) \S+`, Replace: "$1 <removed>"},
+			{Action: "dropblock", Pattern: `^crypto pki certificate chain`, End: `^\s+quit`},
+		}},
+		{Name: "noop"}, // conflicts with built-in
+		{Name: "bad", Rules: []conf.FilterRule{{Action: "explode"}}}, // unknown action
+	}
+
+	if err := ft.SetUserFilters(logger, filters); err == nil {
+		t.Errorf("SetUserFilters: expected error")
+	}
+	if _, found := ft.lookup("bad"); found {
+		t.Errorf("invalid filter should not be registered")
+	}
+
+	input := `! Time: Thu Feb 11 15:45:43 2016
+hostname lab1
+crypto pki certificate chain TP-self-signed
+ certificate self-signed 01
+  3082022B 308201
+  quit
+enable secret 5 $1$abcd$efgh
+end`
+
+	expected := `
+hostname lab1
+
+
+
+
+enable secret 5 <removed>
+end`
+
+	output, err := ft.Preview(logger, nil, []string{"site"}, []byte(input))
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if string(output) != expected {
+		t.Errorf("Preview: expected=[%s] got=[%s]", expected, output)
+	}
+
+	// block state must not leak between saved files
+	f, _ := ft.lookup("site")
+	f(logger, false, ft, [][]byte{[]byte("crypto pki certificate chain x")})
+	if out := f(logger, false, ft, [][]byte{[]byte("hostname lab1")}); len(out[0]) == 0 {
+		t.Errorf("filter should not be inside block")
+	}
+
+	// unsaved rules take precedence
+	output, err = ft.Preview(logger, []conf.LineFilter{{Name: "site", Rules: []conf.FilterRule{{Action: "drop", Pattern: `.`}}}}, []string{"site"}, []byte("a\nb"))
+	if err != nil || string(output) != "\n" {
+		t.Errorf("Preview unsaved: output=[%s] err=%v", output, err)
+	}
+	if _, err := ft.Preview(logger, filters, []string{"bad"}, []byte("a")); err == nil {
+		t.Errorf("Preview: expected error for invalid filter")
+	}
+	if _, err := ft.Preview(logger, nil, []string{"missing"}, []byte("a")); err == nil {
+		t.Errorf("Preview: expected error for missing filter")
+	}
+}
+
+func TestFilterChain(t *testing.T) {
+
+	logger := &testLogger{t}
+	ft := NewFilterTable(logger)
+
+	filters := []conf.LineFilter{
+		{Name: "no-banner", Rules: []conf.FilterRule{
+			{Action: "dropblock", Pattern: `^banner motd`, End: `^\^C`},
+		}},
+	}
+
+	input := `Thu Feb 11 15:45:43.545 BRST
+Building configuration...
+interface b
+ description link
+banner motd ^C
+welcome
+^C
+interface a
+ password 7 0822455D0A16
+end`
+
+	expected := `interface a
+ password 7 ` + maskSecret([]byte("0822455D0A16")) + `
+interface b
+ description link
+end`
+
+	output, err := ft.Preview(logger, filters, []string{"iosxr", "no-banner", "mask_secrets_cisco", "drop_empty", "sort_sections"}, []byte(input))
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if string(output) != expected {
+		t.Errorf("Preview: expected=[%s] got=[%s]", expected, output)
+	}
+
+	d := &Device{DevConfig: conf.DevConfig{Attr: conf.DevAttributes{LineFilter: "iosxr", LineFilters: []string{"missing", "drop_empty"}}}}
+	if names := d.LineFilters(); len(names) != 3 || names[0] != "iosxr" {
+		t.Errorf("LineFilters: %v", names)
+	}
+	if chain := ft.chain(logger, false, d.LineFilters()); len(chain) != 2 {
+		t.Errorf("chain: expected=2 got=%d", len(chain))
+	}
+}
+
+func TestFilterSaveFile(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+	ft := NewFilterTable(logger)
+
+	d := NewDevice(logger, &Model{name: "test"}, "lab1", "localhost", "", "", "", "", false)
+
+	// a line broken across blocks is filtered as a single line
+	blocks := [][]byte{[]byte("interface a\n desc"), []byte("ription x\nend\n")}
+	prefix := filepath.Join(repo, "lab1.")
+	if err := d.saveFile(logger, prefix, blocks, []string{"noop"}, false, 10, ft); err != nil {
+		t.Fatalf("saveFile: %v", err)
+	}
+
+	last, lastErr := store.FindLastConfig(prefix, logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	buf, readErr := store.FileRead(last, 1000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	if expected := "interface a\n description x\nend\n"; string(buf) != expected {
+		t.Errorf("saveFile: expected=[%s] got=[%s]", expected, buf)
+	}
+}
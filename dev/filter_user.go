@@ -0,0 +1,218 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+// Actions for user-defined filter rules.
+const (
+	ruleDrop      = "drop"
+	ruleReplace   = "replace"
+	ruleDropBlock = "dropblock"
+)
+
+// userFilter is a compiled user-defined line filter.
+type userFilter struct {
+	name  string
+	rules []userRule
+}
+
+type userRule struct {
+	action  string
+	pattern *regexp.Regexp
+	replace []byte
+	end     *regexp.Regexp
+}
+
+func compileUserFilter(f conf.LineFilter) (*userFilter, error) {
+	if f.Name == "" {
+		return nil, fmt.Errorf("missing filter name")
+	}
+
+	u := &userFilter{name: f.Name}
+
+	for i, r := range f.Rules {
+		pattern, patternErr := regexp.Compile(r.Pattern)
+		if patternErr != nil {
+			return nil, fmt.Errorf("filter '%s' rule %d: bad pattern: %v", f.Name, i, patternErr)
+		}
+		rule := userRule{action: r.Action, pattern: pattern}
+		switch r.Action {
+		case ruleDrop:
+		case ruleReplace:
+			rule.replace = []byte(r.Replace)
+		case ruleDropBlock:
+			if r.End == "" {
+				return nil, fmt.Errorf("filter '%s' rule %d: dropblock missing end pattern", f.Name, i)
+			}
+			end, endErr := regexp.Compile(r.End)
+			if endErr != nil {
+				return nil, fmt.Errorf("filter '%s' rule %d: bad end pattern: %v", f.Name, i, endErr)
+			}
+			rule.end = end
+		default:
+			return nil, fmt.Errorf("filter '%s' rule %d: unknown action: '%s'", f.Name, i, r.Action)
+		}
+		u.rules = append(u.rules, rule)
+	}
+
+	return u, nil
+}
+
+// filter is the MultiLineFunc for user-defined filter.
+func (u *userFilter) filter(logger hasPrintf, debug bool, table *FilterTable, lines [][]byte) [][]byte {
+	var block *userRule // dropblock rule waiting for end of block
+
+	for i, line := range lines {
+		lines[i] = u.filterLine(logger, debug, line, &block)
+	}
+
+	return lines
+}
+
+func (u *userFilter) filterLine(logger hasPrintf, debug bool, line []byte, block **userRule) []byte {
+	if *block != nil {
+		if (*block).end.Match(line) {
+			*block = nil
+		}
+		if debug {
+			logger.Printf("userFilter: %s: block drop: [%s]", u.name, string(line))
+		}
+		return []byte{}
+	}
+
+	for i := range u.rules {
+		r := &u.rules[i]
+		if !r.pattern.Match(line) {
+			continue
+		}
+		switch r.action {
+		case ruleDrop:
+			if debug {
+				logger.Printf("userFilter: %s: drop: [%s]", u.name, string(line))
+			}
+			return []byte{}
+		case ruleReplace:
+			line = r.pattern.ReplaceAll(line, r.replace)
+		case ruleDropBlock:
+			*block = r
+			if debug {
+				logger.Printf("userFilter: %s: block start: [%s]", u.name, string(line))
+			}
+			return []byte{}
+		}
+	}
+
+	return line
+}
+
+// SetUserFilters replaces user-defined line filters.
+// Invalid filters are reported and skipped.
+func (t *FilterTable) SetUserFilters(logger hasPrintf, filters []conf.LineFilter) error {
+	user, err := t.compileUserFilters(filters)
+
+	t.userLock.Lock()
+	t.user = user
+	t.userLock.Unlock()
+
+	for name := range user {
+		logger.Printf("user line filter registered: '%s'", name)
+	}
+
+	return err
+}
+
+func (t *FilterTable) compileUserFilters(filters []conf.LineFilter) (map[string]*userFilter, error) {
+	user := map[string]*userFilter{}
+	var errs []string
+
+	for _, f := range filters {
+		if _, found := t.table[f.Name]; found {
+			errs = append(errs, fmt.Sprintf("filter '%s': conflicts with built-in filter", f.Name))
+			continue
+		}
+		if _, found := user[f.Name]; found {
+			errs = append(errs, fmt.Sprintf("filter '%s': duplicate name", f.Name))
+			continue
+		}
+		u, compileErr := compileUserFilter(f)
+		if compileErr != nil {
+			errs = append(errs, compileErr.Error())
+			continue
+		}
+		user[f.Name] = u
+	}
+
+	if len(errs) > 0 {
+		return user, fmt.Errorf("user filters: %s", strings.Join(errs, "; "))
+	}
+
+	return user, nil
+}
+
+// lookup finds line filter by name.
+func (t *FilterTable) lookup(name string) (MultiLineFunc, bool) {
+	if f, found := t.table[name]; found {
+		return f, true
+	}
+
+	t.userLock.RLock()
+	u, found := t.user[name]
+	t.userLock.RUnlock()
+
+	if !found {
+		return nil, false
+	}
+
+	return u.filter, true
+}
+
+// chain finds line filters by name, skipping unknown names.
+func (t *FilterTable) chain(logger hasPrintf, debug bool, names []string) []MultiLineFunc {
+	var list []MultiLineFunc
+	for _, name := range names {
+		f, found := t.lookup(name)
+		if !found {
+			if debug {
+				logger.Printf("filter chain: filter '%s' not found", name)
+			}
+			continue
+		}
+		list = append(list, f)
+	}
+	return list
+}
+
+// Preview applies filter chain to input, as saveCommit would do.
+// Filters are looked up first in the given user-defined filters, allowing unsaved rules to be tested.
+func (t *FilterTable) Preview(logger hasPrintf, filters []conf.LineFilter, names []string, input []byte) ([]byte, error) {
+	user, compileErr := t.compileUserFilters(filters)
+
+	var chain []MultiLineFunc
+
+	for _, name := range names {
+		if u, found := user[name]; found {
+			chain = append(chain, u.filter)
+			continue
+		}
+		for _, uf := range filters {
+			if uf.Name == name {
+				return nil, compileErr // filter given but invalid
+			}
+		}
+		f, found := t.lookup(name)
+		if !found {
+			return nil, fmt.Errorf("line filter not found: '%s'", name)
+		}
+		chain = append(chain, f)
+	}
+
+	lines := applyFilters(logger, false, t, chain, bytes.Split(input, []byte{'\n'}))
+
+	return bytes.Join(lines, []byte{'\n'}), nil
+}
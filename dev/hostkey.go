@@ -0,0 +1,278 @@
+package dev
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/udhos/jazigo/store"
+)
+
+// SSH host key verification modes.
+const (
+	HostKeyCheckTOFU   = "tofu"   // trust on first use: record unknown keys, reject changed keys
+	HostKeyCheckStrict = "strict" // reject any key not found in known_hosts
+)
+
+const knownHostsMaxSize = 10000000 // 10M
+
+// knownHostsLock serializes updates to known_hosts files from concurrent fetches.
+var knownHostsLock sync.Mutex
+
+// ValidateHostKeyCheck rejects unknown host key verification modes, instead of silently falling back to tofu.
+func ValidateHostKeyCheck(mode string) error {
+	switch mode {
+	case "", HostKeyCheckTOFU, HostKeyCheckStrict:
+		return nil
+	}
+	return fmt.Errorf("unknown hostkeycheck: '%s' (expected: %s or %s)", mode, HostKeyCheckTOFU, HostKeyCheckStrict)
+}
+
+// KnownHostsPath gets the path for the known_hosts file under the repository.
+func KnownHostsPath(repository string) string {
+	return filepath.Join(repository, "known_hosts")
+}
+
+// hostKeyError reports a host key which could not be verified against known_hosts.
+type hostKeyError struct {
+	hostPort string
+	key      ssh.PublicKey   // key offered by the host
+	known    []ssh.PublicKey // keys recorded for the host (empty if host is unknown)
+}
+
+func (e *hostKeyError) Error() string {
+	if len(e.known) == 0 {
+		return fmt.Sprintf("hostKeyCheck: %s unknown host key %s %s", e.hostPort, e.key.Type(), ssh.FingerprintSHA256(e.key))
+	}
+	return fmt.Sprintf("hostKeyCheck: %s HOST KEY CHANGED: offered %s %s", e.hostPort, e.key.Type(), ssh.FingerprintSHA256(e.key))
+}
+
+type knownHostsLine struct {
+	raw   []byte
+	hosts []string
+	key   ssh.PublicKey // nil for comments and unparseable lines
+}
+
+// hostKeyChecker verifies host keys for a single SSH connection.
+// The failure, if any, is kept in field failed.
+type hostKeyChecker struct {
+	logger hasPrintf
+	path   string
+	mode   string
+	failed *hostKeyError
+}
+
+func newHostKeyChecker(logger hasPrintf, repository, mode string) *hostKeyChecker {
+	return &hostKeyChecker{logger: logger, path: KnownHostsPath(repository), mode: mode}
+}
+
+func (c *hostKeyChecker) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+
+	if err := ValidateHostKeyCheck(c.mode); err != nil {
+		return fmt.Errorf("hostKeyCheck: %s: %v", hostname, err)
+	}
+
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	lines, loadErr := knownHostsLoad(c.path)
+	if loadErr != nil {
+		return fmt.Errorf("hostKeyCheck: %s: %v", c.path, loadErr)
+	}
+
+	known := knownHostsFind(lines, hostname)
+	for _, k := range known {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return nil // found
+		}
+	}
+
+	if len(known) == 0 && c.mode != HostKeyCheckStrict {
+		// trust on first use
+		lines = append(lines, knownHostsNewLine(hostname, key))
+		if saveErr := knownHostsSave(c.path, lines); saveErr != nil {
+			return fmt.Errorf("hostKeyCheck: %s: %v", c.path, saveErr)
+		}
+		c.logger.Printf("hostKeyCheck: %s recorded new host key %s %s", hostname, key.Type(), ssh.FingerprintSHA256(key))
+		return nil
+	}
+
+	c.failed = &hostKeyError{hostPort: hostname, key: key, known: known}
+
+	return c.failed
+}
+
+func knownHostsLoad(path string) ([]knownHostsLine, error) {
+	if !store.FileExists(path) {
+		return nil, nil
+	}
+
+	buf, readErr := store.FileRead(path, knownHostsMaxSize)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	var lines []knownHostsLine
+
+	for _, raw := range bytes.Split(buf, []byte{LF}) {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		line := knownHostsLine{raw: raw}
+		marker, hosts, key, _, _, parseErr := ssh.ParseKnownHosts(raw)
+		if parseErr == nil && marker == "" {
+			line.hosts = hosts
+			line.key = key
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func knownHostsSave(path string, lines []knownHostsLine) error {
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.Write(l.raw)
+		buf.WriteByte(LF)
+	}
+	return store.FileWrite(path, buf.Bytes())
+}
+
+func knownHostsNewLine(hostPort string, key ssh.PublicKey) knownHostsLine {
+	host := knownhosts.Normalize(hostPort)
+	return knownHostsLine{raw: []byte(knownhosts.Line([]string{host}, key)), hosts: []string{host}, key: key}
+}
+
+func knownHostsMatch(line knownHostsLine, hostPort string) bool {
+	if line.key == nil {
+		return false
+	}
+	host := knownhosts.Normalize(hostPort)
+	for _, h := range line.hosts {
+		if knownhosts.Normalize(h) == host || knownHostsHashMatch(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownHostsHashMatch checks hashed known_hosts entry "|1|salt|hash" against normalized host.
+func knownHostsHashMatch(entry, host string) bool {
+	if !strings.HasPrefix(entry, "|1|") {
+		return false
+	}
+	fields := strings.Split(entry[3:], "|")
+	if len(fields) != 2 {
+		return false
+	}
+	salt, saltErr := base64.StdEncoding.DecodeString(fields[0])
+	if saltErr != nil {
+		return false
+	}
+	hash, hashErr := base64.StdEncoding.DecodeString(fields[1])
+	if hashErr != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+func knownHostsFind(lines []knownHostsLine, hostPort string) []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for _, l := range lines {
+		if knownHostsMatch(l, hostPort) {
+			keys = append(keys, l.key)
+		}
+	}
+	return keys
+}
+
+// KnownHostKeys lists fingerprints of keys recorded for host in the repository known_hosts file.
+func KnownHostKeys(repository, hostPort string) ([]string, error) {
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	lines, loadErr := knownHostsLoad(KnownHostsPath(repository))
+	if loadErr != nil {
+		return nil, loadErr
+	}
+
+	var list []string
+	for _, k := range knownHostsFind(lines, forceHostPort(hostPort, "22")) {
+		list = append(list, k.Type()+" "+ssh.FingerprintSHA256(k))
+	}
+
+	return list, nil
+}
+
+// AcceptHostKey replaces the keys recorded for a host with the key rejected by the last fetch for the device.
+// The host is either the device itself or its jump host.
+func AcceptHostKey(tab DeviceUpdater, logger hasPrintf, repository, devID string) error {
+	d, getErr := tab.GetDevice(devID)
+	if getErr != nil {
+		return fmt.Errorf("AcceptHostKey: %v", getErr)
+	}
+
+	pending := d.hostKeyPending
+	if pending == nil {
+		return fmt.Errorf("AcceptHostKey: no pending host key for device '%s'", devID)
+	}
+
+	key := pending.key
+	hostPort := pending.hostPort
+	path := KnownHostsPath(repository)
+
+	knownHostsLock.Lock()
+	defer knownHostsLock.Unlock()
+
+	lines, loadErr := knownHostsLoad(path)
+	if loadErr != nil {
+		return fmt.Errorf("AcceptHostKey: %s: %v", path, loadErr)
+	}
+
+	// drop previous keys for host
+	kept := lines[:0]
+	for _, l := range lines {
+		if !knownHostsMatch(l, hostPort) {
+			kept = append(kept, l)
+		}
+	}
+
+	kept = append(kept, knownHostsNewLine(hostPort, key))
+
+	if saveErr := knownHostsSave(path, kept); saveErr != nil {
+		return fmt.Errorf("AcceptHostKey: %s: %v", path, saveErr)
+	}
+
+	logger.Printf("AcceptHostKey: device %s host %s accepted key %s %s", devID, hostPort, key.Type(), ssh.FingerprintSHA256(key))
+
+	d.hostKeyPending = nil
+	tab.UpdateDevice(d)
+
+	return nil
+}
+
+// HostKeyPending gets the fingerprint for the host key rejected by the last fetch, if any.
+// The host is shown when the key belongs to a jump host.
+func (d *Device) HostKeyPending() string {
+	p := d.hostKeyPending
+	if p == nil {
+		return ""
+	}
+	fingerprint := p.key.Type() + " " + ssh.FingerprintSHA256(p.key)
+	if knownhosts.Normalize(p.hostPort) != knownhosts.Normalize(forceHostPort(d.HostPort, "22")) {
+		fingerprint += " (" + p.hostPort + ")"
+	}
+	return fingerprint
+}
@@ -0,0 +1,122 @@
+package dev
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/temp"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, genErr := ed25519.GenerateKey(rand.Reader)
+	if genErr != nil {
+		t.Fatalf("newTestHostKey: %v", genErr)
+	}
+	key, keyErr := ssh.NewPublicKey(pub)
+	if keyErr != nil {
+		t.Fatalf("newTestHostKey: %v", keyErr)
+	}
+	return key
+}
+
+func TestHostKeyCheck(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+	key1 := newTestHostKey(t)
+	key2 := newTestHostKey(t)
+
+	// strict: unknown host is rejected
+	strict := newHostKeyChecker(logger, repo, HostKeyCheckStrict)
+	if err := strict.check("router1:22", nil, key1); err == nil {
+		t.Errorf("strict: unknown key accepted")
+	}
+	if strict.failed == nil || len(strict.failed.known) != 0 {
+		t.Errorf("strict: expected unknown host failure: %v", strict.failed)
+	}
+
+	// tofu: unknown host is recorded
+	if err := newHostKeyChecker(logger, repo, HostKeyCheckTOFU).check("router1:22", nil, key1); err != nil {
+		t.Errorf("tofu: first use: %v", err)
+	}
+
+	// recorded key is accepted in any mode
+	if err := newHostKeyChecker(logger, repo, HostKeyCheckStrict).check("router1:22", nil, key1); err != nil {
+		t.Errorf("strict: known key: %v", err)
+	}
+
+	// changed key is rejected in any mode
+	tofu := newHostKeyChecker(logger, repo, "")
+	if err := tofu.check("router1:22", nil, key2); err == nil {
+		t.Errorf("tofu: changed key accepted")
+	}
+	if tofu.failed == nil || len(tofu.failed.known) != 1 {
+		t.Errorf("tofu: expected changed key failure: %v", tofu.failed)
+	}
+
+	// other port is another host
+	if err := newHostKeyChecker(logger, repo, "").check("router1:2222", nil, key2); err != nil {
+		t.Errorf("tofu: other port: %v", err)
+	}
+
+	known, knownErr := KnownHostKeys(repo, "router1")
+	if knownErr != nil {
+		t.Errorf("KnownHostKeys: %v", knownErr)
+	}
+	if len(known) != 1 {
+		t.Errorf("KnownHostKeys: expected=1 got=%d: %v", len(known), known)
+	}
+
+	// accept changed key from web UI
+	tab := NewDeviceTable()
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "linux", "lab1", "router1", "ssh", "lab", "pass", "", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	d.hostKeyPending = &hostKeyError{hostPort: "router1:22", key: key2}
+	tab.UpdateDevice(d)
+
+	if err := AcceptHostKey(tab, logger, repo, "lab1"); err != nil {
+		t.Errorf("AcceptHostKey: %v", err)
+	}
+	if err := newHostKeyChecker(logger, repo, HostKeyCheckStrict).check("router1:22", nil, key2); err != nil {
+		t.Errorf("strict: accepted key: %v", err)
+	}
+	if err := newHostKeyChecker(logger, repo, HostKeyCheckStrict).check("router1:22", nil, key1); err == nil {
+		t.Errorf("strict: replaced key accepted")
+	}
+	if err := newHostKeyChecker(logger, repo, HostKeyCheckStrict).check("router1:2222", nil, key2); err != nil {
+		t.Errorf("strict: other port lost: %v", err)
+	}
+	if d, _ := tab.GetDevice("lab1"); d.HostKeyPending() != "" {
+		t.Errorf("pending host key not cleared: %s", d.HostKeyPending())
+	}
+
+	// hashed entries
+	hashed := knownHostsLine{raw: []byte(knownhosts.Line([]string{knownhosts.HashHostname("router9")}, key1))}
+	lines, _ := knownHostsLoad(KnownHostsPath(repo))
+	if err := knownHostsSave(KnownHostsPath(repo), append(lines, hashed)); err != nil {
+		t.Fatalf("knownHostsSave: %v", err)
+	}
+	if err := newHostKeyChecker(logger, repo, HostKeyCheckStrict).check("router9:22", nil, key1); err != nil {
+		t.Errorf("strict: hashed entry: %v", err)
+	}
+	if err := newHostKeyChecker(logger, repo, "").check("router9:22", nil, key2); err == nil {
+		t.Errorf("tofu: changed key accepted for hashed entry")
+	}
+
+	// unknown mode is rejected, not handled as tofu
+	if err := newHostKeyChecker(logger, repo, "yes").check("router10:22", nil, key1); err == nil {
+		t.Errorf("unknown mode: key accepted")
+	}
+	cfg := conf.DevConfig{Model: "linux", ID: "lab2", HostPort: "router10", Attr: conf.DevAttributes{HostKeyCheck: "yes"}}
+	if _, err := NewDeviceFromConf(tab, logger, &cfg); err == nil {
+		t.Errorf("NewDeviceFromConf: expected error for unknown hostkeycheck")
+	}
+}
@@ -0,0 +1,262 @@
+package dev
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+// dialFunc opens the underlying connection for a transport.
+type dialFunc func(hostPort string, timeout time.Duration) (net.Conn, error)
+
+func dialDirect(hostPort string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", hostPort, timeout)
+}
+
+// jumpPool shares ssh connections to bastions among fetches.
+// A bastion connection is kept open for jumpIdleTimeout after its last tunnel is closed,
+// then the next scan usually finds it open.
+type jumpPool struct {
+	lock    sync.Mutex
+	clients map[string]*jumpClient // name => bastion connection
+}
+
+type jumpClient struct {
+	name   string
+	jump   conf.JumpHost // settings used for connection
+	ready  chan struct{} // closed when connection attempt is finished
+	client *ssh.Client
+	err    error
+	refs   int
+	idle   *time.Timer // closes idle connection
+}
+
+var jumpIdleTimeout = 5 * time.Minute
+
+var jumpHosts = &jumpPool{clients: map[string]*jumpClient{}}
+
+// FindJumpHost looks up a jump host by name.
+func FindJumpHost(list []conf.JumpHost, name string) (*conf.JumpHost, error) {
+	for i := range list {
+		if list[i].Name == name {
+			return &list[i], nil
+		}
+	}
+	return nil, fmt.Errorf("FindJumpHost: jump host '%s' not found", name)
+}
+
+func (p *jumpPool) acquire(logger hasPrintf, repository string, jump *conf.JumpHost, timeout time.Duration) (*jumpClient, error) {
+
+	p.lock.Lock()
+	jc, found := p.clients[jump.Name]
+	if found && !reflect.DeepEqual(jc.jump, *jump) {
+		// settings changed: do not reuse connection
+		if jc.refs < 1 {
+			p.close(jc)
+		} else {
+			delete(p.clients, jc.name)
+		}
+		found = false
+	}
+	if !found {
+		jc = &jumpClient{name: jump.Name, jump: *jump, ready: make(chan struct{})}
+		p.clients[jump.Name] = jc
+	}
+	jc.refs++
+	if jc.idle != nil {
+		jc.idle.Stop()
+		jc.idle = nil
+	}
+	p.lock.Unlock()
+
+	if !found {
+		jc.client, jc.err = openJumpHost(logger, repository, jump, timeout)
+		close(jc.ready)
+	}
+
+	<-jc.ready
+
+	if jc.err != nil {
+		p.release(jc)
+		return nil, jc.err
+	}
+
+	return jc, nil
+}
+
+func (p *jumpPool) release(jc *jumpClient) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	jc.refs--
+	if jc.refs > 0 {
+		return
+	}
+
+	if jc.client != nil && p.clients[jc.name] == jc {
+		jc.idle = time.AfterFunc(jumpIdleTimeout, func() { p.expire(jc) })
+		return
+	}
+
+	p.close(jc)
+}
+
+// expire closes an idle bastion connection.
+func (p *jumpPool) expire(jc *jumpClient) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if jc.refs > 0 {
+		return // acquired meanwhile
+	}
+
+	p.close(jc)
+}
+
+// close must be called with lock held.
+func (p *jumpPool) close(jc *jumpClient) {
+	if jc.idle != nil {
+		jc.idle.Stop()
+		jc.idle = nil
+	}
+	if p.clients[jc.name] == jc {
+		delete(p.clients, jc.name)
+	}
+	if jc.client != nil {
+		jc.client.Close()
+	}
+}
+
+// discard forgets a broken bastion connection, so that the next fetch reconnects.
+func (p *jumpPool) discard(jc *jumpClient) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.clients[jc.name] == jc {
+		delete(p.clients, jc.name)
+	}
+}
+
+func openJumpHost(logger hasPrintf, repository string, jump *conf.JumpHost, timeout time.Duration) (*ssh.Client, error) {
+
+	hostPort := forceHostPort(jump.HostPort, "22")
+	label := fmt.Sprintf("jump %s %s", jump.Name, hostPort)
+
+	logger.Printf("openJumpHost: %s - opening", label)
+
+	auth := sshAuth{
+		methods:     jump.SSHAuth,
+		keyPaths:    jump.SSHKeyPaths,
+		passphrase:  jump.SSHKeyPassphrase,
+		agentSocket: jump.SSHAgentSocket,
+	}
+
+	authMethods, agentConn, authErr := sshAuthMethods(logger, label, jump.Password, auth)
+	if authErr != nil {
+		return nil, fmt.Errorf("openJumpHost: %v", authErr)
+	}
+	if agentConn != nil {
+		defer agentConn.Close() // agent is only needed during handshake
+	}
+
+	hostKeys := newHostKeyChecker(logger, repository, jump.HostKeyCheck)
+
+	config := sshClientConfig(jump.User, authMethods, timeout, hostKeys)
+
+	cli, dialErr := ssh.Dial("tcp", hostPort, config)
+	if dialErr != nil {
+		if hostKeys.failed != nil {
+			return nil, hostKeys.failed // unwrapped for fetch to report the bastion host key
+		}
+		return nil, fmt.Errorf("openJumpHost: %s - %v", label, dialErr)
+	}
+
+	logger.Printf("openJumpHost: %s - connected", label)
+
+	return cli, nil
+}
+
+// jumpDialer creates a dialFunc for tunneling connections thru a bastion.
+func jumpDialer(logger hasPrintf, repository string, jump *conf.JumpHost) dialFunc {
+	return func(hostPort string, timeout time.Duration) (net.Conn, error) {
+		jc, acquireErr := jumpHosts.acquire(logger, repository, jump, timeout)
+		if acquireErr != nil {
+			return nil, acquireErr
+		}
+
+		ch, dialErr := jumpDial(jc.client, hostPort, timeout)
+		if dialErr != nil {
+			if _, refused := dialErr.(*ssh.OpenChannelError); !refused {
+				jumpHosts.discard(jc) // bastion connection might be broken
+			}
+			jumpHosts.release(jc)
+			return nil, fmt.Errorf("jumpDialer: %s thru jump %s: %v", hostPort, jump.Name, dialErr)
+		}
+
+		return newTunnelConn(ch, func() { jumpHosts.release(jc) }), nil
+	}
+}
+
+// jumpDial opens a direct-tcpip channel under timeout,
+// since ssh.Client.Dial waits forever for an unresponsive bastion.
+func jumpDial(client *ssh.Client, hostPort string, timeout time.Duration) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	done := make(chan dialResult, 1)
+
+	go func() {
+		conn, err := client.Dial("tcp", hostPort)
+		done <- dialResult{conn, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.conn, r.err
+	case <-time.After(timeout):
+		go func() {
+			if r := <-done; r.conn != nil {
+				r.conn.Close() // late channel
+			}
+		}()
+		return nil, fmt.Errorf("jumpDial: timeout after %v", timeout)
+	}
+}
+
+// tunnelConn provides deadlines for a direct-tcpip channel,
+// since ssh channels do not support deadlines.
+type tunnelConn struct {
+	net.Conn
+	closeOnce sync.Once
+	onClose   func()
+}
+
+func newTunnelConn(ch net.Conn, onClose func()) *tunnelConn {
+	local, remote := net.Pipe()
+
+	go func() {
+		io.Copy(ch, remote)
+		ch.Close()
+	}()
+	go func() {
+		io.Copy(remote, ch)
+		remote.Close()
+	}()
+
+	return &tunnelConn{Conn: local, onClose: onClose}
+}
+
+func (c *tunnelConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.onClose)
+	return err
+}
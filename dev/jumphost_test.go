@@ -0,0 +1,159 @@
+package dev
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestJumpHost(t *testing.T) {
+
+	// launch bogus device behind bastion
+	addr := ":2001"
+	s, listenErr := spawnServerCiscoIOS(t, addr, optionsCiscoIOS{sendUsername: true, sendDisable: true, requestEnablePass: true})
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus CiscoIOS server: %v", listenErr)
+	}
+
+	// launch bogus bastion - old device offering only 3des-cbc
+	var logins int32
+	jumpAddr := ":2002"
+	config := &ssh.ServerConfig{
+		Config: ssh.Config{Ciphers: []string{"3des-cbc"}},
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() != "jumper" || string(pass) != "secret" {
+				return nil, fmt.Errorf("bad password")
+			}
+			atomic.AddInt32(&logins, 1)
+			return nil, nil
+		},
+	}
+	j, jumpErr := spawnServerSSH(t, jumpAddr, config, handleConnectionShell)
+	if jumpErr != nil {
+		t.Fatalf("could not spawn bogus SSH bastion: %v", jumpErr)
+	}
+
+	// run client test
+	devices := 10
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: devices, MaxConfigFiles: 10, JumpHosts: []conf.JumpHost{{Name: "bastion", HostPort: "localhost" + jumpAddr, User: "jumper", Password: "secret"}}})
+	RegisterModels(logger, tab)
+	for i := 0; i < devices; i++ {
+		id := fmt.Sprintf("lab%02d", i)
+		CreateDevice(tab, logger, "cisco-ios", id, "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+		d, _ := tab.GetDevice(id)
+		d.JumpHost = "bastion"
+		tab.UpdateDevice(d)
+	}
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != devices || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	if n := atomic.LoadInt32(&logins); n < 1 || int(n) >= devices {
+		t.Errorf("bastion connection not shared: logins=%d devices=%d", n, devices)
+	}
+
+	// idle bastion connection is kept for next scan
+	before := atomic.LoadInt32(&logins)
+	good, bad, skip = Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != devices || bad != 0 || skip != 0 {
+		t.Errorf("second scan: good=%d bad=%d skip=%d", good, bad, skip)
+	}
+	if n := atomic.LoadInt32(&logins); n != before {
+		t.Errorf("idle bastion connection not kept: logins before=%d after=%d", before, n)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+	j.close() // shutdown bastion
+
+	<-s.done // wait termination of accept loop goroutine
+	<-j.done
+}
+
+func TestJumpHostKey(t *testing.T) {
+
+	// launch bogus device behind bastion
+	addr := ":2001"
+	s, listenErr := spawnServerCiscoIOS(t, addr, optionsCiscoIOS{sendUsername: true, sendDisable: true, requestEnablePass: true})
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus CiscoIOS server: %v", listenErr)
+	}
+
+	// launch bogus bastion
+	jumpAddr := ":2002"
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	j, jumpErr := spawnServerSSH(t, jumpAddr, config, handleConnectionShell)
+	if jumpErr != nil {
+		t.Fatalf("could not spawn bogus SSH bastion: %v", jumpErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10, JumpHosts: []conf.JumpHost{{Name: "bastion", HostPort: "localhost" + jumpAddr, User: "jumper", Password: "secret", HostKeyCheck: HostKeyCheckStrict}}})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "cisco-ios", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	d.JumpHost = "bastion"
+	tab.UpdateDevice(d)
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+
+	// strict: unknown bastion key is rejected
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 0 || bad != 1 || skip != 0 {
+		t.Errorf("unknown bastion key: good=%d bad=%d skip=%d", good, bad, skip)
+	}
+	if d, _ := tab.GetDevice("lab1"); d.HostKeyPending() == "" {
+		t.Errorf("bastion host key not pending")
+	}
+
+	// accept bastion key from web UI
+	if err := AcceptHostKey(tab, logger, repo, "lab1"); err != nil {
+		t.Errorf("AcceptHostKey: %v", err)
+	}
+	if known, _ := KnownHostKeys(repo, "localhost"+jumpAddr); len(known) != 1 {
+		t.Errorf("bastion key not recorded: %v", known)
+	}
+
+	good, bad, skip = Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("accepted bastion key: good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+	j.close() // shutdown bastion
+
+	<-s.done // wait termination of accept loop goroutine
+	<-j.done
+}
@@ -0,0 +1,153 @@
+package dev
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+)
+
+// maskPrefix marks a masked secret: "<secret:keyid:hmac>", or "<secret>" when no masking key is loaded.
+const maskPrefix = "<secret"
+
+// maskKeySize is the size of random masking key.
+const maskKeySize = 32
+
+// maskKey is the per-install key for hashing secrets.
+type maskKey struct {
+	id  string // identifies the key in masked secrets
+	key []byte
+}
+
+var (
+	maskKeyLock    sync.RWMutex
+	maskKeyCurrent *maskKey // nil means no key: secrets are fully redacted
+)
+
+// LoadMaskKey loads the key for hashing masked secrets, creating a random key if the file does not exist.
+// The key must be kept outside the repository, otherwise secrets could be recovered from their hashes by brute force.
+func LoadMaskKey(logger hasPrintf, path string) error {
+	buf, readErr := ioutil.ReadFile(path)
+	if os.IsNotExist(readErr) {
+		buf = make([]byte, maskKeySize)
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return fmt.Errorf("LoadMaskKey: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(buf)+"\n"), 0600); err != nil {
+			return fmt.Errorf("LoadMaskKey: %v", err)
+		}
+		logger.Printf("LoadMaskKey: created new key: %s", path)
+	} else {
+		if readErr != nil {
+			return fmt.Errorf("LoadMaskKey: %v", readErr)
+		}
+		key, hexErr := hex.DecodeString(string(bytes.TrimSpace(buf)))
+		if hexErr != nil || len(key) < 16 {
+			return fmt.Errorf("LoadMaskKey: %s: expecting at least 16 hex-encoded bytes", path)
+		}
+		buf = key
+	}
+
+	k := setMaskKey(buf)
+
+	logger.Printf("LoadMaskKey: key id=%s loaded from: %s", k.id, path)
+
+	return nil
+}
+
+func setMaskKey(key []byte) *maskKey {
+	var k *maskKey
+	if key != nil {
+		sum := sha256.Sum256(key)
+		k = &maskKey{id: hex.EncodeToString(sum[:3]), key: key}
+	}
+	maskKeyLock.Lock()
+	maskKeyCurrent = k
+	maskKeyLock.Unlock()
+	return k
+}
+
+func getMaskKey() *maskKey {
+	maskKeyLock.RLock()
+	defer maskKeyLock.RUnlock()
+	return maskKeyCurrent
+}
+
+// maskRules find secrets in saved lines, keyed by rule set name.
+// Models select their rule set with the MaskRules attribute, then rules for one vendor never touch other vendors' output.
+// The first submatch of every rule is the secret to be masked.
+var maskRules = map[string][]*regexp.Regexp{
+	"cisco": {
+		regexp.MustCompile(`^\s*enable (?:secret|password)\s+(?:level \d+\s+)?(?:[0-9]\s+)?(\S+)(?:\s+(?:encrypted|pbkdf2))?\s*$`), // enable secret 5 $1$abcd$efgh / enable password abcd encrypted
+		regexp.MustCompile(`^\s*username \S+\s.*?\b(?:password|secret)\s+(?:[0-9]\s+)?(\S+)`),                                      // username lab privilege 15 password 7 0822455D0A16
+		regexp.MustCompile(`^\s*(?:password|passwd)\s+(?:[0-9]\s+)?(\S+)(?:\s+encrypted)?\s*$`),                                    //  password 7 0822455D0A16 / passwd abcd encrypted
+		regexp.MustCompile(`^\s*neighbor \S+ password\s+(?:[0-9]\s+)?(\S+)\s*$`),                                                   //  neighbor 10.0.0.1 password 7 0822455D0A16
+		regexp.MustCompile(`^\s*(?:tacacs-server|radius-server)\b.*\bkey\s+(?:[07]\s+)?(\S+)`),                                     // tacacs-server host 10.0.0.1 key 7 0822455D0A16
+		regexp.MustCompile(`^\s+key\s+[07]\s+(\S+)\s*$`),                                                                           //  key 7 0822455D0A16
+		regexp.MustCompile(`^\s*key-string\s+(?:[07]\s+)?(\S+)\s*$`),                                                               //  key-string 7 0822455D0A16
+		regexp.MustCompile(`^\s*crypto isakmp key\s+(?:[0-9]\s+)?(\S+)`),                                                           // crypto isakmp key psk123 address 10.0.0.1
+		regexp.MustCompile(`^\s*pre-shared-key\s+(?:(?:local|remote)\s+)?(?:[0-9]\s+)?(\S+)\s*$`),                                  //  pre-shared-key local psk123
+		regexp.MustCompile(`^\s*snmp-server community\s+(?:[0-9]\s+)?(\S+)`),                                                       // snmp-server community public RO
+		regexp.MustCompile(`^\s*snmp-server user \S+ .*\bauth (?:md5|sha\S*)\s+(\S+)`),                                             // snmp-server user lab network-admin auth md5 0x1234 priv 0x5678 localizedkey
+		regexp.MustCompile(`^\s*snmp-server user \S+ .*\bpriv (?:(?:des|3des|aes\S*)\s+)?(\S+)`),                                   // snmp-server user lab network-admin auth md5 0x1234 priv aes-128 0x5678 localizedkey
+	},
+	"junos": {
+		regexp.MustCompile(`"(\$9\$[^"]+)"`),                   // authentication-key "$9$abcd"; / set snmp community "$9$abcd"
+		regexp.MustCompile(`\bencrypted-password\s+"([^"]+)"`), // encrypted-password "$6$abcd$efgh";
+		regexp.MustCompile(`^\s*set snmp community\s+(\S+)`),   // set snmp community public authorization read-only
+	},
+	"fortios": {
+		regexp.MustCompile(`^\s*set \S+ ENC\s+(\S+)`), // set password ENC SH2abcd
+	},
+	"huawei": {
+		regexp.MustCompile(`\b(?:irreversible-)?cipher\s+(\S+)`), // local-user lab password irreversible-cipher $1a$abcd$ / snmp-agent community read cipher %^%#abcd%^%#
+	},
+}
+
+// maskSecrets replaces secrets found in line by rules with stable hashes.
+// The same secret always produces the same hash under the same key, then diffs still show when a secret changed.
+func maskSecrets(rules []*regexp.Regexp, line []byte) []byte {
+	for _, re := range rules {
+		matches := re.FindAllSubmatchIndex(line, -1)
+		if matches == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		last := 0
+		for _, m := range matches {
+			begin, end := m[2], m[3]
+			secret := line[begin:end]
+			if bytes.Contains(secret, []byte(maskPrefix)) {
+				continue // already masked by previous rule
+			}
+			buf.Write(line[last:begin])
+			buf.WriteString(maskSecret(secret))
+			last = end
+		}
+		buf.Write(line[last:])
+
+		line = buf.Bytes()
+	}
+
+	return line
+}
+
+// maskSecret hashes a secret with HMAC under the masking key.
+// The key id tells which key produced the hash, since hashes under different keys are not comparable.
+func maskSecret(secret []byte) string {
+	k := getMaskKey()
+	if k == nil {
+		return maskPrefix + ">"
+	}
+	mac := hmac.New(sha256.New, k.key)
+	mac.Write(secret)
+	return maskPrefix + ":" + k.id + ":" + hex.EncodeToString(mac.Sum(nil)[:6]) + ">"
+}
@@ -0,0 +1,114 @@
+package dev
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestMaskSecrets(t *testing.T) {
+
+	setMaskKey([]byte("0123456789abcdef0123456789abcdef"))
+	defer setMaskKey(nil)
+
+	cases := []struct {
+		rules  string
+		line   string
+		secret string // "" means line must not change
+	}{
+		{"cisco", "enable secret 5 $1$abcd$efgh", "$1$abcd$efgh"},
+		{"cisco", "enable password 8Ry2YjIyt7RRXU24 encrypted", "8Ry2YjIyt7RRXU24"},
+		{"cisco", "username lab privilege 15 password 7 0822455D0A16", "0822455D0A16"},
+		{"cisco", " password 7 0822455D0A16", "0822455D0A16"},
+		{"cisco", " neighbor 10.0.0.1 password 7 0822455D0A16", "0822455D0A16"},
+		{"cisco", "tacacs-server host 10.0.0.1 key 7 0822455D0A16", "0822455D0A16"},
+		{"cisco", " key 7 0822455D0A16", "0822455D0A16"},
+		{"cisco", " key-string 7 0822455D0A16", "0822455D0A16"},
+		{"cisco", "crypto isakmp key psk123 address 10.0.0.1", "psk123"},
+		{"cisco", "snmp-server community public RO", "public"},
+		{"cisco", "snmp-server user lab network-admin auth md5 0x1234 localizedkey", "0x1234"},
+		{"cisco", "snmp-server user lab network-admin priv aes-128 0x5678 localizedkey", "0x5678"},
+		{"cisco", "service password-encryption", ""},
+		{"cisco", "key chain KEYS", ""},
+		{"cisco", " key 1", ""},
+		{"cisco", "hostname lab1", ""},
+		{"cisco", "ssh cipher encryption high", ""},
+		{"cisco", " description password reset for secret lab", ""},
+		{"cisco", "password is required", ""},
+		{"junos", "            authentication-key \"$9$abcdefgh\"; ## SECRET-DATA", "$9$abcdefgh"},
+		{"junos", "            encrypted-password \"$6$abcd$efgh\"; ## SECRET-DATA", "$6$abcd$efgh"},
+		{"junos", "set snmp community public authorization read-only", "public"},
+		{"junos", "            description \"password secret\";", ""},
+		{"fortios", "        set password ENC SH2abcdefgh", "SH2abcdefgh"},
+		{"huawei", " local-user lab password irreversible-cipher $1a$abcd$", "$1a$abcd$"},
+		{"huawei", " snmp-agent community read cipher %^%#abcd%^%#", "%^%#abcd%^%#"},
+		{"huawei", " description enable secret lab", ""},
+	}
+
+	for _, c := range cases {
+		masked := string(maskSecrets(maskRules[c.rules], []byte(c.line)))
+		if c.secret == "" {
+			if masked != c.line {
+				t.Errorf("%s: unexpected masking: [%s] => [%s]", c.rules, c.line, masked)
+			}
+			continue
+		}
+		if strings.Contains(masked, c.secret) {
+			t.Errorf("%s: secret not masked: [%s] => [%s]", c.rules, c.line, masked)
+		}
+		hash := maskSecret([]byte(c.secret))
+		if strings.Count(masked, maskPrefix) != 1 || !strings.Contains(masked, hash) {
+			t.Errorf("%s: expected single mask %s: [%s] => [%s]", c.rules, hash, c.line, masked)
+		}
+	}
+
+	// stable hash
+	if maskSecret([]byte("a")) != maskSecret([]byte("a")) || maskSecret([]byte("a")) == maskSecret([]byte("b")) {
+		t.Errorf("mask should be stable and distinct")
+	}
+
+	// other key: other key id and hash
+	masked := maskSecret([]byte("a"))
+	k := setMaskKey([]byte("fedcba9876543210fedcba9876543210"))
+	if other := maskSecret([]byte("a")); other == masked || !strings.HasPrefix(other, maskPrefix+":"+k.id+":") {
+		t.Errorf("other key: expected other key id %s: %s => %s", k.id, masked, other)
+	}
+
+	// no key: full redaction
+	setMaskKey(nil)
+	if m := maskSecret([]byte("a")); m != "<secret>" {
+		t.Errorf("no key: expected full redaction: %s", m)
+	}
+}
+
+func TestLoadMaskKey(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+	defer setMaskKey(nil)
+
+	logger := &testLogger{t}
+	path := filepath.Join(repo, "mask.key")
+
+	if err := LoadMaskKey(logger, path); err != nil {
+		t.Fatalf("LoadMaskKey: create: %v", err)
+	}
+	created := maskSecret([]byte("a"))
+
+	setMaskKey(nil)
+	if err := LoadMaskKey(logger, path); err != nil {
+		t.Fatalf("LoadMaskKey: reload: %v", err)
+	}
+	if reloaded := maskSecret([]byte("a")); reloaded != created {
+		t.Errorf("LoadMaskKey: reloaded key differs: %s => %s", created, reloaded)
+	}
+
+	bad := filepath.Join(repo, "bad.key")
+	ioutil.WriteFile(bad, []byte("short\n"), 0600)
+	if err := LoadMaskKey(logger, bad); err == nil {
+		t.Errorf("LoadMaskKey: expected error for bad key")
+	}
+}
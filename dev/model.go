@@ -6,6 +6,7 @@ import (
 	"io"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/udhos/jazigo/conf"
@@ -16,6 +17,8 @@ import (
 type Model struct {
 	name        string
 	defaultAttr conf.DevAttributes
+
+	file string // definition file for models loaded from models directory - "" for built-in models
 }
 
 // Device is an specific device.
@@ -28,6 +31,8 @@ type Device struct {
 	lastTry     time.Time
 	lastSuccess time.Time
 	lastElapsed time.Duration
+
+	hostKeyPending *hostKeyError // host key rejected by last fetch
 }
 
 // Username gets the username for login into a device.
@@ -73,18 +78,33 @@ func (d *Device) Holdtime(now time.Time, holdtime time.Duration) time.Duration {
 
 // RegisterModels adds known device models.
 func RegisterModels(logger hasPrintf, t *DeviceTable) {
+	registerModelAristaEOS(logger, t)
+	registerModelArubaCX(logger, t)
 	registerModelCiscoNGA(logger, t)
 	registerModelCiscoAPIC(logger, t)
+	registerModelCiscoASA(logger, t)
 	registerModelCiscoIOS(logger, t)
 	registerModelCiscoIOSXR(logger, t)
+	registerModelCiscoIOSXRNetconf(logger, t)
+	registerModelCiscoNXOS(logger, t)
 	registerModelDatacomDmswitch(logger, t)
+	registerModelEdgeOS(logger, t)
+	registerModelF5BigIP(logger, t)
+	registerModelFiles(logger, t)
 	registerModelFortiOS(logger, t)
+	registerModelHPEComware(logger, t)
 	registerModelHTTP(logger, t)
 	registerModelHuaweiVRP(logger, t)
 	registerModelJunOS(logger, t)
+	registerModelJunOSNetconf(logger, t)
 	registerModelLinux(logger, t)
 	registerModelMikrotik(logger, t)
+	registerModelNokiaSROS(logger, t)
+	registerModelOPNsense(logger, t)
+	registerModelPaloAltoPANOS(logger, t)
+	registerModelPfSense(logger, t)
 	registerModelRun(logger, t)
+	registerModelVyOS(logger, t)
 }
 
 // CreateDevice creates a new device in the device table.
@@ -119,6 +139,9 @@ func NewDeviceFromConf(tab *DeviceTable, logger hasPrintf, cfg *conf.DevConfig)
 	if getErr != nil {
 		return nil, fmt.Errorf("NewDeviceFromConf: could not find model '%s': %v", cfg.Model, getErr)
 	}
+	if checkErr := ValidateHostKeyCheck(cfg.Attr.HostKeyCheck); checkErr != nil {
+		return nil, fmt.Errorf("NewDeviceFromConf: %v", checkErr)
+	}
 	d := &Device{logger: logger, devModel: mod, DevConfig: *cfg}
 	return d, nil
 }
@@ -139,6 +162,7 @@ const (
 	fetchErrPager    = 5
 	fetchErrCommands = 6
 	fetchErrSave     = 7
+	fetchErrHostKey  = 8
 )
 
 // FetchRequest is a request for fetching a device configuration.
@@ -157,6 +181,8 @@ type FetchResult struct {
 	Code        int       // result error code
 	Begin       time.Time // begin timestamp
 	End         time.Time // end timestamp
+
+	hostKey *hostKeyError // host key rejected by verification
 }
 
 type hasPrintf interface {
@@ -164,20 +190,21 @@ type hasPrintf interface {
 }
 
 type dialog struct {
-	save [][]byte
+	save      [][]byte
+	artifacts map[string][][]byte // artifact name => saved blocks
 }
 
 // Fetch captures a configuration for a device.
 // Fetch runs in a per-device goroutine.
 func (d *Device) Fetch(tab DeviceUpdater, logger hasPrintf, resultCh chan FetchResult, delay time.Duration, repository, logPathPrefix string, opt *conf.AppConfig, ft *FilterTable) {
 
-	result := d.fetch(logger, delay, repository, opt.MaxConfigFiles, ft)
+	result := d.fetch(logger, delay, repository, opt, ft)
 
 	result.End = time.Now()
 
 	good := result.Code == fetchErrNone
 
-	updateDeviceStatus(tab, d.ID, good, result.End, result.End.Sub(result.Begin), logger, opt.Holdtime)
+	updateDeviceStatus(tab, d.ID, good, result.End, result.End.Sub(result.Begin), result.hostKey, logger, opt.Holdtime)
 
 	errlog(logger, result, logPathPrefix, d.Debug, d.Attr.ErrlogHistSize)
 
@@ -186,7 +213,7 @@ func (d *Device) Fetch(tab DeviceUpdater, logger hasPrintf, resultCh chan FetchR
 	}
 }
 
-func (d *Device) createTransport(logger hasPrintf) (transp, string, bool, error) {
+func (d *Device) createTransport(logger hasPrintf, repository string, opt *conf.AppConfig) (transp, string, bool, error) {
 	modelName := d.devModel.name
 
 	if modelName == "run" {
@@ -194,10 +221,50 @@ func (d *Device) createTransport(logger hasPrintf) (transp, string, bool, error)
 		return openTransportPipe(logger, modelName, d.ID, d.HostPort, d.Transports, d.LoginUser, d.LoginPassword, d.Attr.RunProg, d.Debug, d.Attr.RunTimeout)
 	}
 
-	return openTransport(logger, modelName, d.ID, d.HostPort, d.Transports, d.Username(), d.LoginPassword)
+	hostKeys := newHostKeyChecker(logger, repository, d.Attr.HostKeyCheck)
+
+	dial, dialErr := d.dialer(logger, repository, opt)
+	if dialErr != nil {
+		return nil, d.Transports, false, fmt.Errorf("createTransport: %v", dialErr)
+	}
+
+	auth := sshAuth{
+		methods:     d.SSHAuth,
+		keyPaths:    d.SSHKeyPaths,
+		passphrase:  d.SSHKeyPassphrase,
+		agentSocket: d.SSHAgentSocket,
+	}
+
+	return openTransport(logger, modelName, d.ID, d.HostPort, d.Transports, d.Username(), d.LoginPassword, auth, hostKeys, dial)
 }
 
-func (d *Device) fetch(logger hasPrintf, delay time.Duration, repository string, maxFiles int, ft *FilterTable) FetchResult {
+// dialer gets the dialFunc for reaching the device, possibly thru jump host and proxy.
+func (d *Device) dialer(logger hasPrintf, repository string, opt *conf.AppConfig) (dialFunc, error) {
+	dial := dialDirect
+	if d.JumpHost != "" {
+		jump, jumpErr := FindJumpHost(opt.JumpHosts, d.JumpHost)
+		if jumpErr != nil {
+			return nil, jumpErr
+		}
+		dial = jumpDialer(logger, repository, jump)
+	}
+
+	proxy := d.Proxy
+	if proxy == "" {
+		proxy = opt.Proxy
+	}
+	if proxy != "" && proxy != ProxyNone {
+		proxyDial, proxyErr := proxyDialer(proxy, dial)
+		if proxyErr != nil {
+			return nil, proxyErr
+		}
+		dial = proxyDial
+	}
+
+	return dial, nil
+}
+
+func (d *Device) fetch(logger hasPrintf, delay time.Duration, repository string, opt *conf.AppConfig, ft *FilterTable) FetchResult {
 	modelName := d.devModel.name
 
 	if delay > 0 {
@@ -206,8 +273,19 @@ func (d *Device) fetch(logger hasPrintf, delay time.Duration, repository string,
 
 	begin := time.Now()
 
-	session, transport, logged, err := d.createTransport(logger)
+	// urllist and filelist replace the command dialog, for any model
+	switch {
+	case len(d.Attr.URLList) > 0:
+		return d.fetchHTTP(logger, begin, repository, opt, ft)
+	case len(d.Attr.FileList) > 0:
+		return d.fetchFiles(logger, begin, repository, opt, ft)
+	}
+
+	session, transport, logged, err := d.createTransport(logger, repository, opt)
 	if err != nil {
+		if keyErr, isKeyErr := err.(*hostKeyError); isKeyErr {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("fetch transport: %v", err), Code: fetchErrHostKey, Begin: begin, hostKey: keyErr}
+		}
 		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("fetch transport: %v", err), Code: fetchErrTransp, Begin: begin}
 	}
 
@@ -219,6 +297,21 @@ func (d *Device) fetch(logger hasPrintf, delay time.Duration, repository string,
 
 	enabled := false
 
+	if len(d.Attr.Dialog) > 0 {
+		d.debugf("will run dialog script")
+
+		if dialogErr := d.runDialog(logger, session, &capture); dialogErr != nil {
+			d.saveRollback(logger, &capture)
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("dialog: %v", dialogErr), Code: fetchErrCommands, Begin: begin}
+		}
+
+		if saveErr := d.saveCommit(logger, &capture, repository, opt.MaxConfigFiles, ft); saveErr != nil {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("save commit: %v", saveErr), Code: fetchErrSave, Begin: begin}
+		}
+
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Code: fetchErrNone, Begin: begin}
+	}
+
 	d.debugf("will login")
 
 	if d.Attr.NeedLoginChat && !logged {
@@ -257,9 +350,18 @@ func (d *Device) fetch(logger hasPrintf, delay time.Duration, repository string,
 		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("commands: %v", cmdErr), Code: fetchErrCommands, Begin: begin}
 	}
 
+	if len(d.Attr.ContextList) > 0 {
+		d.debugf("will send commands to contexts")
+
+		if ctxErr := d.changetoContexts(logger, session, &capture); ctxErr != nil {
+			d.saveRollback(logger, &capture)
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("contexts: %v", ctxErr), Code: fetchErrCommands, Begin: begin}
+		}
+	}
+
 	d.debugf("will save results")
 
-	if saveErr := d.saveCommit(logger, &capture, repository, maxFiles, ft); saveErr != nil {
+	if saveErr := d.saveCommit(logger, &capture, repository, opt.MaxConfigFiles, ft); saveErr != nil {
 		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transport, Msg: fmt.Sprintf("save commit: %v", saveErr), Code: fetchErrSave, Begin: begin}
 	}
 
@@ -268,6 +370,7 @@ func (d *Device) fetch(logger hasPrintf, delay time.Duration, repository string,
 
 func (d *Device) saveRollback(logger hasPrintf, capture *dialog) {
 	capture.save = nil
+	capture.artifacts = nil
 }
 
 func deviceDirectory(repository, id string) string {
@@ -296,6 +399,10 @@ func (d *Device) DevicePathPrefix(devDir string) string {
 
 func (d *Device) saveCommit(logger hasPrintf, capture *dialog, repository string, maxFiles int, ft *FilterTable) error {
 
+	if artifactErr := validateArtifacts(d.Attr.Artifacts); artifactErr != nil {
+		return fmt.Errorf("saveCommit: %v", artifactErr)
+	}
+
 	devDir := d.DeviceDir(repository)
 
 	if mkdirErr := store.MkDir(devDir); mkdirErr != nil {
@@ -304,57 +411,141 @@ func (d *Device) saveCommit(logger hasPrintf, capture *dialog, repository string
 
 	devPathPrefix := d.DevicePathPrefix(devDir)
 
-	// writeFunc: copy command outputs into file
-	writeFunc := func(w store.HasWrite) error {
+	// main file is skipped only when all outputs went into artifacts
+	if len(capture.save) > 0 || len(capture.artifacts) < 1 {
+		if saveErr := d.saveFile(logger, devPathPrefix, capture.save, d.LineFilters(), d.Attr.ChangesOnly, maxFiles, ft); saveErr != nil {
+			return fmt.Errorf("saveCommit: %v", saveErr)
+		}
+	}
 
-		lineFilter, filterFound := ft.table[d.Attr.LineFilter]
-		if filterFound {
-			d.debugf("saveCommit: filter '%s' FOUND", d.Attr.LineFilter)
-		} else {
-			if d.Attr.LineFilter != "" {
-				d.debugf("saveCommit: filter '%s' not found", d.Attr.LineFilter)
-			}
+	for _, a := range d.Attr.Artifacts {
+		blocks, found := capture.artifacts[a.Name]
+		if !found {
+			continue
+		}
+		filters := a.LineFilters
+		if len(filters) < 1 {
+			filters = d.LineFilters()
+		}
+		if saveErr := d.saveFile(logger, devPathPrefix+a.Name+".", blocks, filters, a.ChangesOnly, maxFiles, ft); saveErr != nil {
+			return fmt.Errorf("saveCommit: artifact '%s': %v", a.Name, saveErr)
 		}
+	}
 
-		lineNum := 1
+	return nil
+}
 
-		for _, b := range capture.save {
+// saveFile saves blocks thru filter chain into a new file under path prefix.
+func (d *Device) saveFile(logger hasPrintf, pathPrefix string, blocks [][]byte, filters []string, changesOnly bool, maxFiles int, ft *FilterTable) error {
 
-			var lines [][]byte
-			if filterFound {
-				lines = bytes.Split(b, []byte{'\n'}) // split block into lines
-			} else {
-				lines = [][]byte{b} // use block as single line
-			}
+	// writeFunc: copy command outputs into file
+	writeFunc := func(w store.HasWrite) error {
 
-			for _, line := range lines {
+		chain := ft.chain(d, d.Debug, filters)
+		if len(chain) > 0 {
+			d.debugf("saveFile: filters %v FOUND: %d", filters, len(chain))
+		}
 
-				if filterFound {
-					line = lineFilter(d, d.Debug, ft, line, lineNum) // apply filter
-					line = append(line, '\n')                        // restore LF removed by split
-				}
+		var mask []*regexp.Regexp
+		if d.Attr.MaskSecrets {
+			var found bool
+			if mask, found = maskRules[d.Attr.MaskRules]; !found {
+				return fmt.Errorf("writeFunc: unknown secret masking rules: '%s'", d.Attr.MaskRules)
+			}
+		}
 
-				n, writeErr := w.Write(line)
-				if writeErr != nil {
-					return fmt.Errorf("saveCommit: writeFunc: error: %v", writeErr)
-				}
-				if n != len(line) {
-					return fmt.Errorf("saveCommit: writeFunc: partial: wrote=%d size=%d", n, len(line))
+		if len(chain) < 1 && len(mask) < 1 {
+			// no filter: save blocks as is
+			for _, b := range blocks {
+				if writeErr := writeAll(w, b); writeErr != nil {
+					return fmt.Errorf("writeFunc: %v", writeErr)
 				}
+			}
+			return nil
+		}
+
+		// blocks might break lines, then join blocks before splitting into lines
+		lines := bytes.Split(bytes.Join(blocks, nil), []byte{'\n'})
+		if last := len(lines) - 1; len(lines[last]) == 0 {
+			lines = lines[:last] // drop empty line after final LF
+		}
+
+		lines = applyFilters(d, d.Debug, ft, chain, lines)
 
-				lineNum++
+		for _, line := range lines {
+			if len(mask) > 0 {
+				line = maskSecrets(mask, line)
+			}
+			line = append(line, '\n') // restore LF removed by split
+			if writeErr := writeAll(w, line); writeErr != nil {
+				return fmt.Errorf("writeFunc: %v", writeErr)
 			}
 		}
+
 		return nil
 	}
 
-	path, writeErr := store.SaveNewConfig(devPathPrefix, maxFiles, logger, writeFunc, d.Attr.ChangesOnly, d.Attr.S3ContentType)
+	// commit info for git store
+	info := store.CommitInfo{
+		AuthorName:  d.ID,
+		AuthorEmail: d.devModel.name + "@jazigo",
+		Message:     fmt.Sprintf("%s: %s %s", d.ID, d.devModel.name, d.HostPort),
+	}
+
+	path, writeErr := store.SaveNewConfigInfo(pathPrefix, maxFiles, logger, writeFunc, changesOnly, d.Attr.S3ContentType, info)
 	if writeErr != nil {
-		return fmt.Errorf("saveCommit: error: %v", writeErr)
+		return fmt.Errorf("error: %v", writeErr)
+	}
+
+	logger.Printf("saveFile: dev '%s' saved to '%s'", d.ID, path)
+
+	return nil
+}
+
+var artifactName = regexp.MustCompile(`^[\w-]+$`)
+
+// validateArtifacts checks artifact names and commands.
+func validateArtifacts(artifacts []conf.Artifact) error {
+	names := map[string]bool{}
+	commands := map[string]string{}
+	for i, a := range artifacts {
+		if !artifactName.MatchString(a.Name) {
+			return fmt.Errorf("artifact %d: bad name: '%s'", i, a.Name)
+		}
+		if _, err := strconv.Atoi(a.Name); err == nil {
+			return fmt.Errorf("artifact %d: numeric name: '%s'", i, a.Name)
+		}
+		if names[a.Name] {
+			return fmt.Errorf("artifact %d: duplicate name: '%s'", i, a.Name)
+		}
+		names[a.Name] = true
+		for _, c := range a.Commands {
+			if other, found := commands[c]; found {
+				return fmt.Errorf("artifact '%s': command '%s' already saved into artifact '%s'", a.Name, c, other)
+			}
+			commands[c] = a.Name
+		}
 	}
+	return nil
+}
 
-	logger.Printf("saveCommit: dev '%s' saved to '%s'", d.ID, path)
+// LineFilters lists filter chain names: LineFilter followed by LineFilters.
+func (d *Device) LineFilters() []string {
+	var names []string
+	if d.Attr.LineFilter != "" {
+		names = append(names, d.Attr.LineFilter)
+	}
+	return append(names, d.Attr.LineFilters...)
+}
 
+func writeAll(w store.HasWrite, b []byte) error {
+	n, writeErr := w.Write(b)
+	if writeErr != nil {
+		return fmt.Errorf("error: %v", writeErr)
+	}
+	if n != len(b) {
+		return fmt.Errorf("partial: wrote=%d size=%d", n, len(b))
+	}
 	return nil
 }
 
@@ -362,6 +553,15 @@ type hasTimeout interface {
 	Timeout() bool
 }
 
+// matchTimeoutError is returned when match times out.
+type matchTimeoutError struct {
+	msg string
+}
+
+func (e matchTimeoutError) Error() string {
+	return e.msg
+}
+
 func (d *Device) match(logger hasPrintf, t transp, capture *dialog, patterns []string) (int, []byte, error) {
 
 	d.debugf("match: begin")
@@ -395,7 +595,7 @@ READ_LOOP:
 	for {
 		now := time.Now()
 		if now.Sub(begin) > d.Attr.MatchTimeout {
-			return badIndex, matchBuf, fmt.Errorf("match: timed out: %s", d.Attr.MatchTimeout)
+			return badIndex, matchBuf, matchTimeoutError{fmt.Sprintf("match: timed out: %s", d.Attr.MatchTimeout)}
 		}
 
 		deadline := now.Add(d.Attr.ReadTimeout)
@@ -414,7 +614,7 @@ READ_LOOP:
 		if readErr != nil {
 			if te, ok := readErr.(hasTimeout); ok {
 				if te.Timeout() {
-					return badIndex, matchBuf, fmt.Errorf("match: read timed out: %v", readErr)
+					return badIndex, matchBuf, matchTimeoutError{fmt.Sprintf("match: read timed out: %v", readErr)}
 				}
 			}
 			switch readErr {
@@ -594,6 +794,8 @@ func (d *Device) sendCommands(logger hasPrintf, t transp, capture *dialog) error
 
 func (d *Device) save(logger hasPrintf, capture *dialog, command string, buf []byte) error {
 
+	artifact := d.artifact(command)
+
 	if command != "" {
 		command = fmt.Sprintf("%q", command)
 		if d.Attr.QuoteSentCommandsFormat != "" {
@@ -602,10 +804,31 @@ func (d *Device) save(logger hasPrintf, capture *dialog, command string, buf []b
 		command = "\n" + command + "\n"
 	}
 
+	if artifact != "" {
+		if capture.artifacts == nil {
+			capture.artifacts = map[string][][]byte{}
+		}
+		capture.artifacts[artifact] = append(capture.artifacts[artifact], []byte(command), buf)
+		return nil
+	}
+
 	capture.save = append(capture.save, []byte(command), buf)
 	return nil
 }
 
+// artifact finds the artifact saving the command output.
+// Empty name means device main file.
+func (d *Device) artifact(command string) string {
+	for _, a := range d.Attr.Artifacts {
+		for _, c := range a.Commands {
+			if c == command {
+				return a.Name
+			}
+		}
+	}
+	return ""
+}
+
 func (d *Device) pagingOff(logger hasPrintf, t transp, capture *dialog) error {
 
 	if pagerErr := d.sendln(logger, t, d.Attr.DisablePagerCommand); pagerErr != nil {
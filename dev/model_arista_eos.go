@@ -0,0 +1,37 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func registerModelAristaEOS(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = true
+	a.NeedPagingOff = true
+	a.EnableCommand = "enable"
+	a.UsernamePromptPattern = `login:\s*$`
+	a.PasswordPromptPattern = `Password:\s*$`
+	a.EnablePasswordPromptPattern = `Password:\s*$`
+	a.DisabledPromptPattern = `\S+>\s*$`
+	a.EnabledPromptPattern = `\S+#\s*$`
+	a.CommandList = []string{"show version", "show running-config"}
+	a.DisablePagerCommand = "terminal length 0"
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'show running-config'
+	a.CommandMatchTimeout = 30 * time.Second // larger timeout for slow 'show running-config'
+	a.QuoteSentCommandsFormat = `!![%s]`
+	a.LineFilter = "arista-eos" // line filter name - applied to every saved line
+	a.MaskRules = "cisco"
+
+	m := &Model{name: "arista-eos"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelAristaEOS: %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+type optionsAristaEOS struct {
+	sendUsername      bool
+	sendDisable       bool
+	requestEnablePass bool
+	breakConn         bool
+}
+
+func TestAristaEOS1(t *testing.T) {
+	testAristaEOS(t, ":2001", optionsAristaEOS{sendUsername: true, sendDisable: true, requestEnablePass: true}, 1)
+}
+
+func TestAristaEOS2(t *testing.T) {
+	testAristaEOS(t, ":2002", optionsAristaEOS{sendUsername: false}, 1)
+}
+
+func TestAristaEOS3(t *testing.T) {
+	testAristaEOS(t, ":2003", optionsAristaEOS{sendUsername: true, sendDisable: true, breakConn: true}, 0)
+}
+
+func testAristaEOS(t *testing.T, addr string, options optionsAristaEOS, expectGood int) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	s, listenErr := spawnServerAristaEOS(t, addr, options)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus AristaEOS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "arista-eos", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != expectGood || bad != 1-expectGood || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	if expectGood < 1 {
+		return
+	}
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"Arista DCS-7050TX-64", "hostname sw1"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"Uptime:", "Free memory:", "! Time:"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("volatile line %q found in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerAristaEOS(t *testing.T, addr string, options optionsAristaEOS) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopAristaEOS(t, s, handleConnectionAristaEOS, options)
+
+	return s, nil
+}
+
+func acceptLoopAristaEOS(t *testing.T, s *testServer, handler func(*testing.T, net.Conn, optionsAristaEOS), options optionsAristaEOS) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopAristaEOS: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn, options)
+	}
+
+	close(s.done)
+}
+
+const aristaEOSShowVersion = `Arista DCS-7050TX-64
+Hardware version:    01.11
+Serial number:       JPE12345678
+System MAC address:  001c.7300.0001
+
+Software image version: 4.20.1F
+Architecture:           i386
+Internal build version: 4.20.1F-6820520.4201F
+Internal build ID:      790a11e8-5aaf-4be7-a11a-e61795d05b91
+
+Uptime:                 5 weeks, 2 days, 3 hours and 12 minutes
+Total memory:           8152324 kB
+Free memory:            5624316 kB
+`
+
+const aristaEOSShowRun = `! Command: show running-config
+! device: sw1 (DCS-7050TX-64, EOS-4.20.1F)
+! Time: Thu Feb 11 15:45:43 2016
+!
+hostname sw1
+!
+interface Ethernet1
+   description uplink
+!
+end
+`
+
+func handleConnectionAristaEOS(t *testing.T, c net.Conn, options optionsAristaEOS) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	if options.sendUsername {
+		// send username prompt
+		if _, err := c.Write([]byte("Bogus AristaEOS server\nsw1 login: ")); err != nil {
+			t.Logf("handleConnectionAristaEOS: send username prompt error: %v", err)
+			return
+		}
+
+		// consume username
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionAristaEOS: read username error: %v", err)
+			return
+		}
+	}
+
+	// send password prompt
+	if _, err := c.Write([]byte("\nPassword: ")); err != nil {
+		t.Logf("handleConnectionAristaEOS: send password prompt error: %v", err)
+		return
+	}
+
+	// consume password
+	if _, err := c.Read(buf); err != nil {
+		t.Logf("handleConnectionAristaEOS: read password error: %v", err)
+		return
+	}
+
+	enabled := !options.sendDisable
+
+LOOP:
+	for {
+
+		prompt := ">"
+		if enabled {
+			prompt = "#"
+		}
+
+		// send command prompt
+		if _, err := c.Write([]byte(fmt.Sprintf("\nsw1%s", prompt))); err != nil {
+			t.Logf("handleConnectionAristaEOS: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr == io.EOF {
+				return // peer closed connection
+			}
+			t.Logf("handleConnectionAristaEOS: read command error: %v", readErr)
+			return
+		}
+
+		str := strings.TrimSpace(string(buf[:n]))
+
+		switch {
+		case strings.HasPrefix(str, "q"): //quit
+			break LOOP
+		case strings.HasPrefix(str, "ex"): //exit
+			break LOOP
+		case str == "terminal length 0":
+			if _, err := c.Write([]byte("\nPagination disabled.")); err != nil {
+				t.Logf("handleConnectionAristaEOS: send pagination error: %v", err)
+				return
+			}
+		case str == "show version":
+			if _, err := c.Write([]byte("\n" + aristaEOSShowVersion)); err != nil {
+				t.Logf("handleConnectionAristaEOS: send show version error: %v", err)
+				return
+			}
+		case str == "show running-config":
+
+			if options.breakConn {
+				// break connection (on defer/exit)
+				return
+			}
+
+			if _, err := c.Write([]byte("\n" + aristaEOSShowRun)); err != nil {
+				t.Logf("handleConnectionAristaEOS: send show running-config error: %v", err)
+				return
+			}
+		case str == "enable":
+			if !enabled {
+				if options.requestEnablePass {
+					// send password prompt
+					if _, err := c.Write([]byte("\nPassword: ")); err != nil {
+						t.Logf("handleConnectionAristaEOS: send enable password prompt error: %v", err)
+						return
+					}
+
+					// consume password
+					if _, err := c.Read(buf); err != nil {
+						t.Logf("handleConnectionAristaEOS: read enable password error: %v", err)
+						return
+					}
+				}
+
+				enabled = true
+			}
+		default:
+			if _, err := c.Write([]byte("\n% Invalid input")); err != nil {
+				t.Logf("handleConnectionAristaEOS: send unknown command error: %v", err)
+				return
+			}
+		}
+
+	}
+
+	// send bye
+	if _, err := c.Write([]byte("\nbye\n")); err != nil {
+		t.Logf("handleConnectionAristaEOS: send bye error: %v", err)
+		return
+	}
+
+}
@@ -0,0 +1,172 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestArubaCX(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerArubaCX(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus ArubaCX server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "aruba-cx", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"Version      : FL.10.04.0001", "hostname switch"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"Invalid input", "Current configuration:"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerArubaCX(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopArubaCX(t, s, handleConnectionArubaCX)
+
+	return s, nil
+}
+
+func acceptLoopArubaCX(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopArubaCX: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+const arubaCXShowVersion = `-----------------------------------------------------------------------------
+ArubaOS-CX
+(c) Copyright 2017-2020 Hewlett Packard Enterprise Development LP
+-----------------------------------------------------------------------------
+Version      : FL.10.04.0001
+Build Date   : 2019-10-14 19:31:55 UTC
+`
+
+const arubaCXShowRunningConfig = `Current configuration:
+!
+!Version ArubaOS-CX FL.10.04.0001
+!export-password: default
+hostname switch
+!
+interface 1/1/1
+    no shutdown
+`
+
+// handleConnectionArubaCX: bogus Aruba AOS-CX
+func handleConnectionArubaCX(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Bogus ArubaCX server\n\nswitch login: ", "\nPassword: "} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionArubaCX: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionArubaCX: read login error: %v", err)
+			return
+		}
+	}
+
+	for {
+		// send command prompt
+		if _, err := c.Write([]byte("\nswitch# ")); err != nil {
+			t.Logf("handleConnectionArubaCX: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionArubaCX: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch cmd {
+		case "":
+		case "exit":
+			return
+		case "no page":
+		case "show version":
+			out = arubaCXShowVersion
+		case "show running-config":
+			out = arubaCXShowRunningConfig
+		default:
+			out = "Invalid input: " + cmd
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionArubaCX: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
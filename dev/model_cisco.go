@@ -26,6 +26,8 @@ func registerModelCiscoIOS(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 30 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `!![%s]`
+	a.LineFilter = "cisco-ios" // line filter name - applied to every saved line
+	a.MaskRules = "cisco"
 
 	m := &Model{name: "cisco-ios"}
 	m.defaultAttr = a
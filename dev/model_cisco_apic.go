@@ -20,6 +20,7 @@ func registerModelCiscoAPIC(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 60 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `!![%s]`
+	a.LineFilter = "cisco-apic" // line filter name - applied to every saved line
 
 	m := &Model{name: "cisco-apic"}
 	m.defaultAttr = a
@@ -0,0 +1,126 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func registerModelCiscoASA(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = true
+	a.NeedPagingOff = true
+	a.EnableCommand = "enable"
+	a.UsernamePromptPattern = `Username:\s*$`
+	a.PasswordPromptPattern = `Password:\s*$`
+	a.EnablePasswordPromptPattern = `Password:\s*$`
+	a.DisabledPromptPattern = `\S+>\s*$` // asa> asa/ctx1>
+	a.EnabledPromptPattern = `\S+#\s*$`  // asa# asa/ctx1#
+	a.CommandList = []string{"show version", "show running-config"}
+	a.DisablePagerCommand = "terminal pager 0"
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 60 * time.Second   // 'show running-config all' may pause for a long time
+	a.CommandMatchTimeout = 120 * time.Second // 'show running-config all' may pause for a long time
+	a.QuoteSentCommandsFormat = `!![%s]`
+	a.LineFilter = "cisco-asa" // line filter name - applied to every saved line
+	a.MaskRules = "cisco"
+
+	m := &Model{name: "cisco-asa"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelCiscoASA: %v", err)
+	}
+}
+
+// asaContextLine matches context lines from "show context":
+//
+//	Context Name      Class      Interfaces           Mode         URL
+//	*admin            default    Management0/0        Routed       disk0:/admin.cfg
+//	 ctx1             default    GigabitEthernet0/1   Transparent  disk0:/ctx1.cfg
+var asaContextLine = regexp.MustCompile(`^[ *]?(\S+)\s+.*\s(Routed|Transparent)(\s|$)`)
+
+// changetoContexts runs CommandList within every context in ContextList, then returns to system context.
+func (d *Device) changetoContexts(logger hasPrintf, t transp, capture *dialog) error {
+
+	contexts := d.Attr.ContextList
+
+	if len(contexts) == 1 && contexts[0] == "*" {
+		list, listErr := d.listContexts(logger, t, capture)
+		if listErr != nil {
+			return fmt.Errorf("changetoContexts: %v", listErr)
+		}
+		contexts = list
+	}
+
+	for _, ctx := range contexts {
+		if err := d.changeto(logger, t, capture, "context "+ctx, true); err != nil {
+			return fmt.Errorf("changetoContexts: %v", err)
+		}
+		if err := d.sendCommands(logger, t, capture); err != nil {
+			return fmt.Errorf("changetoContexts: context '%s': %v", ctx, err)
+		}
+	}
+
+	if err := d.changeto(logger, t, capture, "system", false); err != nil {
+		return fmt.Errorf("changetoContexts: %v", err)
+	}
+
+	return nil
+}
+
+func (d *Device) changeto(logger hasPrintf, t transp, capture *dialog, target string, save bool) error {
+	cmd := "changeto " + target
+
+	if err := d.sendln(logger, t, cmd); err != nil {
+		return fmt.Errorf("could not send '%s': %v", cmd, err)
+	}
+
+	matchBuf, _, _, matchErr := d.matchCommandPrompt(t, capture)
+	if matchErr != nil {
+		return fmt.Errorf("'%s': could not match command prompt: %v buf=[%s]", cmd, matchErr, matchBuf)
+	}
+
+	if !save {
+		return nil
+	}
+
+	// record context change as header for following commands
+	return d.save(logger, capture, cmd, nil)
+}
+
+func (d *Device) listContexts(logger hasPrintf, t transp, capture *dialog) ([]string, error) {
+	const cmd = "show context"
+
+	if err := d.sendln(logger, t, cmd); err != nil {
+		return nil, fmt.Errorf("listContexts: could not send '%s': %v", cmd, err)
+	}
+
+	matchBuf, _, _, matchErr := d.matchCommandPrompt(t, capture)
+	if matchErr != nil && matchErr != io.EOF {
+		return nil, fmt.Errorf("listContexts: could not match command prompt: %v buf=[%s]", matchErr, matchBuf)
+	}
+
+	var list []string
+	for _, line := range bytes.Split(matchBuf, []byte{LF}) {
+		line = bytes.TrimRight(line, "\r")
+		if m := asaContextLine.FindSubmatch(line); m != nil {
+			list = append(list, string(m[1]))
+		}
+	}
+
+	if len(list) < 1 {
+		return nil, fmt.Errorf("listContexts: no context found: buf=[%s]", matchBuf)
+	}
+
+	d.debugf("listContexts: %v", list)
+
+	return list, nil
+}
@@ -0,0 +1,210 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestCiscoASA1(t *testing.T) {
+	testCiscoASA(t, ":2001", nil, []string{"hostname asa"}, []string{"changeto context"})
+}
+
+func TestCiscoASA2(t *testing.T) {
+	contexts := []string{"!![\"changeto context admin\"]", "!![\"changeto context ctx1\"]", "hostname admin", "hostname ctx1"}
+	testCiscoASA(t, ":2002", []string{"*"}, contexts, nil)
+}
+
+func TestCiscoASA3(t *testing.T) {
+	testCiscoASA(t, ":2003", []string{"ctx1"}, []string{"!![\"changeto context ctx1\"]", "hostname ctx1"}, []string{"hostname admin"})
+}
+
+func testCiscoASA(t *testing.T, addr string, contexts, expected, unexpected []string) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	s, listenErr := spawnServerCiscoASA(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus CiscoASA server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "cisco-asa", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	d.Attr.ContextList = contexts
+	tab.UpdateDevice(d)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, e := range expected {
+		if !bytes.Contains(saved, []byte(e)) {
+			t.Errorf("missing %q in saved file: %q", e, saved)
+		}
+	}
+	for _, u := range append(unexpected, "Cryptochecksum", ": Written by", "up 10 days") {
+		if bytes.Contains(saved, []byte(u)) {
+			t.Errorf("unexpected %q in saved file: %q", u, saved)
+		}
+	}
+}
+
+func spawnServerCiscoASA(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopCiscoASA(t, s, handleConnectionCiscoASA)
+
+	return s, nil
+}
+
+func acceptLoopCiscoASA(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopCiscoASA: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+// handleConnectionCiscoASA: bogus ASA in multiple context mode
+func handleConnectionCiscoASA(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Bogus CiscoASA server\nUsername: ", "\nPassword: "} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionCiscoASA: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionCiscoASA: read login error: %v", err)
+			return
+		}
+	}
+
+	enabled := false
+	context := "" // system context
+
+	for {
+		prompt := "asa"
+		if context != "" {
+			prompt += "/" + context
+		}
+		if enabled {
+			prompt += "# "
+		} else {
+			prompt += "> "
+		}
+
+		// send command prompt
+		if _, err := c.Write([]byte("\n" + prompt)); err != nil {
+			t.Logf("handleConnectionCiscoASA: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionCiscoASA: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch {
+		case cmd == "":
+		case cmd == "exit" || cmd == "quit":
+			return
+		case cmd == "enable":
+			if _, err := c.Write([]byte("\nPassword: ")); err != nil {
+				t.Logf("handleConnectionCiscoASA: send enable password prompt error: %v", err)
+				return
+			}
+			if _, err := c.Read(buf); err != nil {
+				t.Logf("handleConnectionCiscoASA: read enable password error: %v", err)
+				return
+			}
+			enabled = true
+		case !enabled:
+			out = "ERROR: % Invalid input detected"
+		case cmd == "terminal pager 0":
+		case cmd == "show version":
+			out = "Cisco Adaptive Security Appliance Software Version 9.8(2)\n\nasa up 10 days 2 hours\n"
+		case cmd == "show context":
+			out = `Context Name      Class      Interfaces           Mode         URL
+*admin            default    Management0/0        Routed       disk0:/admin.cfg
+ ctx1             default    GigabitEthernet0/1   Transparent  disk0:/ctx1.cfg
+
+Total active Security Contexts: 2
+`
+		case cmd == "changeto system":
+			context = ""
+		case cmd == "changeto context admin" || cmd == "changeto context ctx1":
+			context = strings.TrimPrefix(cmd, "changeto context ")
+		case cmd == "show running-config":
+			name := context
+			if name == "" {
+				name = "asa"
+			}
+			out = fmt.Sprintf(": Saved\n:\n: Written by enable_15 at 15:45:43.545 BRST Thu Feb 11 2016\nhostname %s\n!\nCryptochecksum:8f2c4e0a 1d6b7f3e 9a0c2b44 5e7d1f60\n: end\n", name)
+		default:
+			out = "ERROR: % Invalid input detected"
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionCiscoASA: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
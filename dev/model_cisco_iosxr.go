@@ -26,6 +26,7 @@ func registerModelCiscoIOSXR(logger hasPrintf, t *DeviceTable) {
 	a.CommandMatchTimeout = 30 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `!![%s]`
 	a.LineFilter = "iosxr" // line filter name - applied to every saved line
+	a.MaskRules = "cisco"
 
 	m := &Model{name: "cisco-iosxr"}
 	m.defaultAttr = a
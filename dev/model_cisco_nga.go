@@ -20,6 +20,7 @@ func registerModelCiscoNGA(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 15 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 25 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `!![%s]`
+	a.LineFilter = "cisco-nga" // line filter name - applied to every saved line
 
 	m := &Model{name: "cisco-nga"}
 	m.defaultAttr = a
@@ -0,0 +1,228 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+type optionsCiscoNXOS struct {
+	sendUsername bool
+	breakConn    bool
+}
+
+func TestCiscoNXOS1(t *testing.T) {
+	testCiscoNXOS(t, ":2001", optionsCiscoNXOS{sendUsername: true}, 1)
+}
+
+func TestCiscoNXOS2(t *testing.T) {
+	testCiscoNXOS(t, ":2002", optionsCiscoNXOS{sendUsername: true, breakConn: true}, 0)
+}
+
+func testCiscoNXOS(t *testing.T, addr string, options optionsCiscoNXOS, expectGood int) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	s, listenErr := spawnServerCiscoNXOS(t, addr, options)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus CiscoNXOS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "cisco-nxos", "lab1", "localhost"+addr, "telnet", "lab", "pass", "", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != expectGood || bad != 1-expectGood || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	if expectGood < 1 {
+		return
+	}
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"NXOS: version 7.0(3)I7(4)", "hostname nx1", "interface Ethernet1/1"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"Kernel uptime is", "!Time:", "!Running configuration last done"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("volatile line %q found in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerCiscoNXOS(t *testing.T, addr string, options optionsCiscoNXOS) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopCiscoNXOS(t, s, handleConnectionCiscoNXOS, options)
+
+	return s, nil
+}
+
+func acceptLoopCiscoNXOS(t *testing.T, s *testServer, handler func(*testing.T, net.Conn, optionsCiscoNXOS), options optionsCiscoNXOS) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopCiscoNXOS: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn, options)
+	}
+
+	close(s.done)
+}
+
+const ciscoNXOSShowVersion = `Cisco Nexus Operating System (NX-OS) Software
+TAC support: http://www.cisco.com/tac
+
+Software
+  BIOS: version 07.59
+  NXOS: version 7.0(3)I7(4)
+
+Hardware
+  cisco Nexus9000 C93180YC-EX chassis
+  Device name: nx1
+
+Kernel uptime is 12 day(s), 3 hour(s), 4 minute(s), 5 second(s)
+`
+
+const ciscoNXOSShowRun = `
+!Command: show running-config
+!Running configuration last done at: Thu Feb 11 15:45:43 2016
+!Time: Thu Feb 11 15:45:43 2016
+
+version 7.0(3)I7(4) Bios:version 07.59
+hostname nx1
+
+interface Ethernet1/1
+  description uplink
+`
+
+func handleConnectionCiscoNXOS(t *testing.T, c net.Conn, options optionsCiscoNXOS) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	if options.sendUsername {
+		// send username prompt
+		if _, err := c.Write([]byte("Nexus 9000v Switch\nnx1 login: ")); err != nil {
+			t.Logf("handleConnectionCiscoNXOS: send username prompt error: %v", err)
+			return
+		}
+
+		// consume username
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionCiscoNXOS: read username error: %v", err)
+			return
+		}
+	}
+
+	// send password prompt
+	if _, err := c.Write([]byte("\nPassword: ")); err != nil {
+		t.Logf("handleConnectionCiscoNXOS: send password prompt error: %v", err)
+		return
+	}
+
+	// consume password
+	if _, err := c.Read(buf); err != nil {
+		t.Logf("handleConnectionCiscoNXOS: read password error: %v", err)
+		return
+	}
+
+LOOP:
+	for {
+
+		// send command prompt - NX-OS users land directly into exec mode
+		if _, err := c.Write([]byte("\nnx1# ")); err != nil {
+			t.Logf("handleConnectionCiscoNXOS: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr == io.EOF {
+				return // peer closed connection
+			}
+			t.Logf("handleConnectionCiscoNXOS: read command error: %v", readErr)
+			return
+		}
+
+		str := strings.TrimSpace(string(buf[:n]))
+
+		switch {
+		case strings.HasPrefix(str, "q"): //quit
+			break LOOP
+		case strings.HasPrefix(str, "ex"): //exit
+			break LOOP
+		case str == "terminal length 0":
+		case str == "show version":
+			if _, err := c.Write([]byte("\n" + ciscoNXOSShowVersion)); err != nil {
+				t.Logf("handleConnectionCiscoNXOS: send show version error: %v", err)
+				return
+			}
+		case str == "show running-config":
+
+			if options.breakConn {
+				// break connection (on defer/exit)
+				return
+			}
+
+			if _, err := c.Write([]byte("\n" + ciscoNXOSShowRun)); err != nil {
+				t.Logf("handleConnectionCiscoNXOS: send show running-config error: %v", err)
+				return
+			}
+		default:
+			if _, err := c.Write([]byte("\n% Invalid command")); err != nil {
+				t.Logf("handleConnectionCiscoNXOS: send unknown command error: %v", err)
+				return
+			}
+		}
+
+	}
+
+	// send bye
+	if _, err := c.Write([]byte("\nbye\n")); err != nil {
+		t.Logf("handleConnectionCiscoNXOS: send bye error: %v", err)
+		return
+	}
+
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
 	"github.com/udhos/jazigo/temp"
 )
 
@@ -318,3 +319,91 @@ LOOP:
 	}
 
 }
+
+func TestCiscoIOSArtifacts(t *testing.T) {
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerCiscoIOS(t, addr, optionsCiscoIOS{sendUsername: true, sendDisable: true, requestEnablePass: true})
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus CiscoIOS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "cisco-ios", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	d.Attr.Artifacts = []conf.Artifact{{Name: "version", Commands: []string{"show ver"}, LineFilters: []string{"count_lines"}, ChangesOnly: true}}
+	tab.UpdateDevice(d)
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	for i := 0; i < 2; i++ {
+		good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+		if good != 1 || bad != 0 || skip != 0 {
+			t.Errorf("scan %d: good=%d bad=%d skip=%d", i, good, bad, skip)
+		}
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	prefix := DeviceFullPrefix(repo, "lab1")
+
+	_, mainFiles, mainErr := store.ListConfig(prefix, logger)
+	if mainErr != nil || len(mainFiles) != 2 {
+		t.Errorf("main files: expected=2 got=%v: %v", mainFiles, mainErr)
+	}
+	_, versionFiles, versionErr := store.ListConfig(prefix+"version.", logger)
+	if versionErr != nil || len(versionFiles) != 1 {
+		t.Errorf("artifact files (changes only): expected=1 got=%v: %v", versionFiles, versionErr)
+	}
+
+	read := func(p string) string {
+		path, lastErr := store.FindLastConfig(p, logger)
+		if lastErr != nil {
+			t.Fatalf("FindLastConfig: %v", lastErr)
+		}
+		b, readErr := store.FileRead(path, 1000000)
+		if readErr != nil {
+			t.Fatalf("FileRead: %v", readErr)
+		}
+		return string(b)
+	}
+
+	if main := read(prefix); strings.Contains(main, `"show ver"`) || !strings.Contains(main, `"show run"`) {
+		t.Errorf("unexpected main file: %q", main)
+	}
+	if version := read(prefix + "version."); !strings.Contains(version, `"show ver"`) || strings.Contains(version, `"show run"`) || !strings.HasPrefix(version, "1: ") {
+		t.Errorf("unexpected artifact file: %q", version)
+	}
+}
+
+func TestValidateArtifacts(t *testing.T) {
+	bad := [][]conf.Artifact{
+		{{Name: ""}},
+		{{Name: "a/b"}},
+		{{Name: "10"}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Commands: []string{"x"}}, {Name: "b", Commands: []string{"x"}}},
+	}
+	for i, a := range bad {
+		if err := validateArtifacts(a); err == nil {
+			t.Errorf("validateArtifacts: %d: expected error: %v", i, a)
+		}
+	}
+	if err := validateArtifacts([]conf.Artifact{{Name: "show-version_1", Commands: []string{"show ver"}}}); err != nil {
+		t.Errorf("validateArtifacts: unexpected error: %v", err)
+	}
+}
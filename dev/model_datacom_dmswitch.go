@@ -28,6 +28,7 @@ func registerModelDatacomDmswitch(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 15 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 25 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `!![%s]`
+	a.LineFilter = "dmswitch" // line filter name - applied to every saved line
 
 	m := &Model{name: "dmswitch"}
 	m.defaultAttr = a
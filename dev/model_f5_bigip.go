@@ -0,0 +1,32 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func registerModelF5BigIP(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = false
+	a.NeedPagingOff = false // tmsh -q does not page
+	a.UsernamePromptPattern = `login( as)?:\s*$`
+	a.PasswordPromptPattern = `[Pp]assword:\s*$`
+	a.DisabledPromptPattern = `\[\S+@\S+\].*[#$]\s*$` // bash: [root@bigip1:Active:Standalone] config #
+	a.CommandList = []string{`tmsh -q -c "show sys version"`, `tmsh -q -c "cd /; show running-config recursive"`}
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 60 * time.Second   // larger timeout for slow 'show running-config recursive'
+	a.CommandMatchTimeout = 120 * time.Second // larger timeout for slow 'show running-config recursive'
+	a.QuoteSentCommandsFormat = `#[%s]`
+	a.LineFilter = "f5-bigip" // line filter name - applied to every saved line
+
+	m := &Model{name: "f5-bigip"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelF5BigIP: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestF5BigIP(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerF5BigIP(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus F5BigIP server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "f5-bigip", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"BIG-IP 15.1.0", "ltm pool /Common/web", "create-time"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"last-update-time", "command not found"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerF5BigIP(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopF5BigIP(t, s, handleConnectionF5BigIP)
+
+	return s, nil
+}
+
+func acceptLoopF5BigIP(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopF5BigIP: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+const f5BigIPShowSysVersion = `
+Sys::Version
+Main Package
+  Product     BIG-IP 15.1.0
+  Version     15.1.0
+  Build       0.0.31
+`
+
+const f5BigIPShowRunningConfig = `ltm pool /Common/web {
+    members {
+        /Common/10.0.0.1:80 {
+            address 10.0.0.1
+        }
+    }
+}
+sys file ssl-cert /Common/default.crt {
+    create-time 2016-02-11:15:45:43
+    last-update-time 2016-02-11:15:45:43
+    revision 1
+}
+`
+
+// handleConnectionF5BigIP: bogus BIG-IP bash shell
+func handleConnectionF5BigIP(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Bogus F5BigIP server\nlogin as: ", "\nPassword: "} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionF5BigIP: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionF5BigIP: read login error: %v", err)
+			return
+		}
+	}
+
+	for {
+		// send command prompt
+		if _, err := c.Write([]byte("\n[root@bigip1:Active:Standalone] config # ")); err != nil {
+			t.Logf("handleConnectionF5BigIP: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionF5BigIP: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch cmd {
+		case "":
+		case "exit":
+			return
+		case `tmsh -q -c "show sys version"`:
+			out = f5BigIPShowSysVersion
+		case `tmsh -q -c "cd /; show running-config recursive"`:
+			out = f5BigIPShowRunningConfig
+		default:
+			out = "-bash: " + cmd + ": command not found"
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionF5BigIP: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package dev
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+const filesMaxSize = 100000000 // 100M
+
+func registerModelFiles(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.FileList = []string{"/etc/hosts"}
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 20 * time.Second
+	a.CommandMatchTimeout = 60 * time.Second // timeout for copying each file
+	a.QuoteSentCommandsFormat = `##[%s]`
+
+	m := &Model{name: "files"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelFiles: %v", err)
+	}
+}
+
+// fetchFiles copies remote files listed in FileList over ssh.
+// Transports lists the copy methods to try for each file, in order: "sftp" and/or "scp".
+// Default is "sftp,scp", also selected by "ssh".
+func (d *Device) fetchFiles(logger hasPrintf, begin time.Time, repository string, opt *conf.AppConfig, ft *FilterTable) FetchResult {
+	modelName := d.devModel.name
+
+	transports := d.Transports
+	if transports == "" {
+		transports = "ssh"
+	}
+
+	var methods []string
+	for _, t := range strings.Split(transports, ",") {
+		switch t = strings.TrimSpace(t); t {
+		case "ssh":
+			methods = append(methods, "sftp", "scp")
+		case "sftp", "scp":
+			methods = append(methods, t)
+		default:
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("fetch transport: unsupported transport '%s'", t), Code: fetchErrTransp, Begin: begin}
+		}
+	}
+
+	dial, dialErr := d.dialer(logger, repository, opt)
+	if dialErr != nil {
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("fetch transport: %v", dialErr), Code: fetchErrTransp, Begin: begin}
+	}
+
+	hostKeys := newHostKeyChecker(logger, repository, d.Attr.HostKeyCheck)
+
+	auth := sshAuth{
+		methods:     d.SSHAuth,
+		keyPaths:    d.SSHKeyPaths,
+		passphrase:  d.SSHKeyPassphrase,
+		agentSocket: d.SSHAgentSocket,
+	}
+
+	hostPort := forceHostPort(d.HostPort, "22")
+
+	conn, cli, sshErr := dialSSH(logger, modelName, d.ID, hostPort, d.Attr.ReadTimeout, d.Username(), d.LoginPassword, auth, hostKeys, dial)
+	if sshErr != nil {
+		if keyErr, isKeyErr := sshErr.(*hostKeyError); isKeyErr {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("fetch transport: %v", sshErr), Code: fetchErrHostKey, Begin: begin, hostKey: keyErr}
+		}
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("fetch transport: %v", sshErr), Code: fetchErrTransp, Begin: begin}
+	}
+	defer conn.Close()
+	defer cli.Close()
+
+	var getters []fileGetter
+
+	for _, m := range methods {
+		switch m {
+		case "sftp":
+			conn.SetDeadline(time.Now().Add(d.Attr.CommandMatchTimeout)) // server might not speak sftp
+			client, clientErr := sftp.NewClient(cli)
+			if clientErr != nil {
+				logger.Printf("fetchFiles: %s %s %s - sftp: %v", modelName, d.ID, hostPort, clientErr)
+				continue
+			}
+			defer client.Close()
+			getters = append(getters, fileGetter{name: m, get: func(path string) ([]byte, error) {
+				return sftpGet(client, path)
+			}})
+		case "scp":
+			getters = append(getters, fileGetter{name: m, get: func(path string) ([]byte, error) {
+				return scpGet(cli, path)
+			}})
+		}
+	}
+
+	if len(getters) < 1 {
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: "fetch transport: unable to open transport", Code: fetchErrTransp, Begin: begin}
+	}
+
+	capture := dialog{}
+
+	for i, path := range d.Attr.FileList {
+		buf, getErr := getFile(logger, d, conn, getters, path)
+		if getErr != nil {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("commands: file [%d] '%s': %v", i, path, getErr), Code: fetchErrCommands, Begin: begin}
+		}
+
+		if saveErr := d.save(logger, &capture, path, buf); saveErr != nil {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("commands: could not save file '%s': %v", path, saveErr), Code: fetchErrCommands, Begin: begin}
+		}
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	if saveErr := d.saveCommit(logger, &capture, repository, opt.MaxConfigFiles, ft); saveErr != nil {
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Msg: fmt.Sprintf("save commit: %v", saveErr), Code: fetchErrSave, Begin: begin}
+	}
+
+	return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: transports, Code: fetchErrNone, Begin: begin}
+}
+
+// fileGetter copies a remote file with a method like sftp or scp.
+type fileGetter struct {
+	name string
+	get  func(path string) ([]byte, error)
+}
+
+// getFile copies a remote file, falling back to the next method on failure.
+func getFile(logger hasPrintf, d *Device, conn net.Conn, getters []fileGetter, path string) ([]byte, error) {
+	var lastErr error
+	for _, g := range getters {
+		d.debugf("fetchFiles: %s %s", g.name, path)
+
+		conn.SetDeadline(time.Now().Add(d.Attr.CommandMatchTimeout))
+
+		buf, getErr := g.get(path)
+		if getErr == nil {
+			return buf, nil
+		}
+
+		logger.Printf("fetchFiles: %s %s - %s: %v", d.ID, path, g.name, getErr)
+		lastErr = fmt.Errorf("%s: %v", g.name, getErr)
+	}
+	return nil, lastErr
+}
+
+func sftpGet(client *sftp.Client, path string) ([]byte, error) {
+	f, openErr := client.Open(path)
+	if openErr != nil {
+		return nil, openErr
+	}
+	defer f.Close()
+
+	return readLimit(f, filesMaxSize)
+}
+
+// scpGet copies a remote file using the scp "source" protocol (scp -f).
+func scpGet(cli *ssh.Client, path string) ([]byte, error) {
+	ses, sessionErr := cli.NewSession()
+	if sessionErr != nil {
+		return nil, sessionErr
+	}
+	defer ses.Close()
+
+	w, wrErr := ses.StdinPipe()
+	if wrErr != nil {
+		return nil, wrErr
+	}
+	out, outErr := ses.StdoutPipe()
+	if outErr != nil {
+		return nil, outErr
+	}
+	r := bufio.NewReader(out)
+
+	if err := ses.Start("scp -f " + shellQuote(path)); err != nil {
+		return nil, fmt.Errorf("scp: %v", err)
+	}
+
+	ack := func() error {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+
+	if err := ack(); err != nil {
+		return nil, fmt.Errorf("scp: %v", err)
+	}
+
+	for {
+		line, readErr := r.ReadString('\n')
+		if readErr != nil {
+			return nil, fmt.Errorf("scp: read header: %v", readErr)
+		}
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case 'T': // timestamps
+			if err := ack(); err != nil {
+				return nil, fmt.Errorf("scp: %v", err)
+			}
+			continue
+		case 1, 2: // warning, error
+			return nil, fmt.Errorf("scp: remote: %s", strings.TrimSpace(line[1:]))
+		case 'C':
+		default:
+			return nil, fmt.Errorf("scp: unexpected header: %q", line)
+		}
+
+		// C0644 <size> <name>
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("scp: bad header: %q", line)
+		}
+		size, sizeErr := strconv.ParseInt(fields[1], 10, 64)
+		if sizeErr != nil || size < 0 || size > filesMaxSize {
+			return nil, fmt.Errorf("scp: bad size: %q", line)
+		}
+
+		if err := ack(); err != nil {
+			return nil, fmt.Errorf("scp: %v", err)
+		}
+
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("scp: read file: %v", err)
+		}
+
+		status, statusErr := r.ReadByte()
+		if statusErr != nil {
+			return nil, fmt.Errorf("scp: read status: %v", statusErr)
+		}
+		if status != 0 {
+			return nil, fmt.Errorf("scp: remote status: %d", status)
+		}
+
+		if err := ack(); err != nil {
+			return nil, fmt.Errorf("scp: %v", err)
+		}
+
+		w.Close()
+		ses.Wait()
+
+		return buf, nil
+	}
+}
+
+func readLimit(r io.Reader, max int64) ([]byte, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > max {
+		return nil, fmt.Errorf("larger than %d bytes", max)
+	}
+	return buf, nil
+}
+
+// shellQuote quotes s for the remote shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
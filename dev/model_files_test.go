@@ -0,0 +1,170 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestFilesSFTP(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	remote1 := filepath.Join(repo, "remote1.conf")
+	remote2 := filepath.Join(repo, "remote2.conf")
+	ioutil.WriteFile(remote1, []byte("hostname lab1\n"), 0600)
+	ioutil.WriteFile(remote2, []byte("interface eth0\n"), 0600)
+
+	handler := func(t *testing.T, c ssh.Channel) {
+		defer c.Close()
+		server, serverErr := sftp.NewServer(c)
+		if serverErr != nil {
+			t.Errorf("sftp server: %v", serverErr)
+			return
+		}
+		server.Serve()
+	}
+
+	testFiles(t, repo, ":2001", "files", "ssh", handler, []string{remote1, remote2}, []string{"hostname lab1\n", "interface eth0\n"})
+}
+
+func TestFilesSCP(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	testFiles(t, repo, ":2002", "files", "scp", handleConnectionSCP, []string{"/flash/running.cfg"}, []string{scpTestContent})
+}
+
+func TestFilesFallback(t *testing.T) {
+
+	logger := &testLogger{t}
+	d := NewDevice(logger, &Model{name: "files"}, "lab1", "localhost", "ssh", "", "", "", false)
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	var tried []string
+	getter := func(name string, fail bool) fileGetter {
+		return fileGetter{name: name, get: func(path string) ([]byte, error) {
+			tried = append(tried, name)
+			if fail {
+				return nil, fmt.Errorf("%s failed", name)
+			}
+			return []byte(name), nil
+		}}
+	}
+
+	buf, err := getFile(logger, d, conn, []fileGetter{getter("sftp", true), getter("scp", false)}, "/cf/conf/config.xml")
+	if err != nil || string(buf) != "scp" || len(tried) != 2 {
+		t.Errorf("fallback: buf=[%s] tried=%v error: %v", buf, tried, err)
+	}
+
+	tried = nil
+	if _, err := getFile(logger, d, conn, []fileGetter{getter("sftp", true), getter("scp", true)}, "/x"); err == nil || len(tried) != 2 {
+		t.Errorf("all failed: tried=%v error: %v", tried, err)
+	}
+}
+
+// testFiles fetches files from bogus server. Nil files means model default FileList.
+func testFiles(t *testing.T, repo, addr, model, transports string, handler func(*testing.T, ssh.Channel), files, expected []string) {
+
+	// launch bogus test server
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() != "lab" || string(pass) != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return nil, nil
+		},
+	}
+	s, listenErr := spawnServerSSH(t, addr, config, handler)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus SSH server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, model, "lab1", "localhost"+addr, transports, "lab", "pass", "", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	if files == nil {
+		files = d.Attr.FileList
+	} else {
+		d.Attr.FileList = files
+		tab.UpdateDevice(d)
+	}
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for i, e := range expected {
+		if !bytes.Contains(saved, []byte(e)) || !bytes.Contains(saved, []byte(files[i])) {
+			t.Errorf("missing file %s in saved file: %q", files[i], saved)
+		}
+	}
+}
+
+const scpTestContent = "hostname asa1\n"
+
+// handleConnectionSCP: bogus scp source
+func handleConnectionSCP(t *testing.T, c ssh.Channel) {
+	defer c.Close()
+
+	ack := make([]byte, 1)
+	expectAck := func() bool {
+		if _, err := io.ReadFull(c, ack); err != nil || ack[0] != 0 {
+			t.Errorf("handleConnectionSCP: bad ack: %v %v", ack, err)
+			return false
+		}
+		return true
+	}
+
+	if !expectAck() {
+		return
+	}
+	fmt.Fprintf(c, "C0644 %d running.cfg\n", len(scpTestContent))
+	if !expectAck() {
+		return
+	}
+	io.WriteString(c, scpTestContent)
+	c.Write([]byte{0})
+	if !expectAck() {
+		return
+	}
+	c.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+}
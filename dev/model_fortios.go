@@ -39,6 +39,8 @@ func registerModelFortiOS(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 60 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `##[%s]`
+	a.LineFilter = "fortios" // line filter name - applied to every saved line
+	a.MaskRules = "fortios"
 
 	m := &Model{name: "fortios"}
 	m.defaultAttr = a
@@ -0,0 +1,33 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func registerModelHPEComware(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = false
+	a.NeedPagingOff = true
+	a.UsernamePromptPattern = `(Username|login):\s*$`
+	a.PasswordPromptPattern = `Password:\s*$`
+	a.DisabledPromptPattern = `<\S+>\s*$` // user view: <HPE>
+	a.CommandList = []string{"display version", "display current-configuration"}
+	a.DisablePagerCommand = "screen-length disable"
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'display current-configuration'
+	a.CommandMatchTimeout = 30 * time.Second // larger timeout for slow 'display current-configuration'
+	a.QuoteSentCommandsFormat = `#[%s]`
+	a.LineFilter = "hpe-comware" // line filter name - applied to every saved line
+
+	m := &Model{name: "hpe-comware"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelHPEComware: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestHPEComware(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerHPEComware(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus HPEComware server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "hpe-comware", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"HPE Comware Software, Version 7.1.070", " sysname HPE"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"uptime is"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerHPEComware(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopHPEComware(t, s, handleConnectionHPEComware)
+
+	return s, nil
+}
+
+func acceptLoopHPEComware(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopHPEComware: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+const hpeComwareDisplayVersion = `HPE Comware Software, Version 7.1.070, Release 3208P10
+Copyright (c) 2010-2018 Hewlett Packard Enterprise Development LP
+HPE 5130 24G 4SFP+ EI Switch uptime is 0 weeks, 0 days, 2 hours, 25 minutes
+Last reboot reason : User reboot
+`
+
+const hpeComwareDisplayCurrentConfiguration = `#
+ version 7.1.070, Release 3208P10
+#
+ sysname HPE
+#
+interface GigabitEthernet1/0/1
+ port link-mode bridge
+#
+return
+`
+
+// handleConnectionHPEComware: bogus HPE Comware in user view
+func handleConnectionHPEComware(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Bogus HPEComware server\n\nLogin authentication\n\nUsername:", "\nPassword:"} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionHPEComware: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionHPEComware: read login error: %v", err)
+			return
+		}
+	}
+
+	for {
+		// send command prompt
+		if _, err := c.Write([]byte("\n<HPE>")); err != nil {
+			t.Logf("handleConnectionHPEComware: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionHPEComware: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch cmd {
+		case "":
+		case "quit":
+			return
+		case "screen-length disable":
+		case "display version":
+			out = hpeComwareDisplayVersion
+		case "display current-configuration":
+			out = hpeComwareDisplayCurrentConfiguration
+		default:
+			out = "              ^\n % Unrecognized command found at '^' position."
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionHPEComware: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -1,26 +1,185 @@
 package dev
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/udhos/jazigo/conf"
 )
 
+const httpMaxBodySize = 100000000 // 100M
+
+// registerModelHTTP registers the models "http" (plain HTTP by default) and "rest" (HTTPS by default).
 func registerModelHTTP(logger hasPrintf, t *DeviceTable) {
 	a := conf.NewDevAttr()
 
-	a.CommandList = []string{"GET / HTTP/1.0\r\n\r\n"}
-	a.ReadTimeout = 5 * time.Second
-	a.MatchTimeout = 10 * time.Second
+	a.URLList = []string{"/"}
+	a.HTTPScheme = "http"
+	a.HTTPPrettyJSON = true
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
 	a.SendTimeout = 5 * time.Second
-	a.CommandReadTimeout = 5 * time.Second   // larger timeout for slow 'sh run'
-	a.CommandMatchTimeout = 10 * time.Second // larger timeout for slow 'sh run'
-	a.SupressAutoLF = true
+	a.CommandReadTimeout = 20 * time.Second  // timeout for response headers
+	a.CommandMatchTimeout = 60 * time.Second // timeout for full request
 	a.QuoteSentCommandsFormat = `[%s]`
+	a.S3ContentType = "detect"
 
 	m := &Model{name: "http"}
 	m.defaultAttr = a
 	if err := t.SetModel(m, logger); err != nil {
 		logger.Printf("registerModelHTTP: %v", err)
 	}
+
+	a.HTTPScheme = "https"
+
+	m = &Model{name: "rest"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelHTTP: %v", err)
+	}
+}
+
+// fetchHTTP captures device configuration from HTTP(S) API endpoints listed in URLList.
+// Transports "http" or "https" select the scheme for relative URLs, otherwise HTTPScheme is used.
+func (d *Device) fetchHTTP(logger hasPrintf, begin time.Time, repository string, opt *conf.AppConfig, ft *FilterTable) FetchResult {
+	modelName := d.devModel.name
+
+	scheme := strings.TrimSpace(d.Transports)
+	if scheme != "http" && scheme != "https" {
+		scheme = "https"
+		if d.Attr.HTTPScheme == "http" {
+			scheme = "http"
+		}
+	}
+
+	client, clientErr := d.httpClient(logger, repository, opt)
+	if clientErr != nil {
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: scheme, Msg: fmt.Sprintf("fetch transport: %v", clientErr), Code: fetchErrTransp, Begin: begin}
+	}
+
+	capture := dialog{}
+
+	for i, u := range d.Attr.URLList {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			if !strings.HasPrefix(u, "/") {
+				u = "/" + u
+			}
+			u = scheme + "://" + d.HostPort + u
+		}
+
+		d.debugf("fetchHTTP: GET %s", u)
+
+		body, getErr := d.httpGet(client, u)
+		if getErr != nil {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: scheme, Msg: fmt.Sprintf("commands: url [%d] '%s': %v", i, u, getErr), Code: fetchErrCommands, Begin: begin}
+		}
+
+		if saveErr := d.save(logger, &capture, u, body); saveErr != nil {
+			return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: scheme, Msg: fmt.Sprintf("commands: could not save url '%s' result: %v", u, saveErr), Code: fetchErrCommands, Begin: begin}
+		}
+	}
+
+	if saveErr := d.saveCommit(logger, &capture, repository, opt.MaxConfigFiles, ft); saveErr != nil {
+		return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: scheme, Msg: fmt.Sprintf("save commit: %v", saveErr), Code: fetchErrSave, Begin: begin}
+	}
+
+	return FetchResult{Model: modelName, DevID: d.ID, DevHostPort: d.HostPort, Transport: scheme, Code: fetchErrNone, Begin: begin}
+}
+
+func (d *Device) httpClient(logger hasPrintf, repository string, opt *conf.AppConfig) (*http.Client, error) {
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.Attr.HTTPInsecureSkipVerify}
+
+	if d.Attr.HTTPCACert != "" {
+		pem, readErr := ioutil.ReadFile(d.Attr.HTTPCACert)
+		if readErr != nil {
+			return nil, fmt.Errorf("httpClient: CA cert: %v", readErr)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("httpClient: CA cert: no certificate found in '%s'", d.Attr.HTTPCACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if d.Attr.HTTPClientCert != "" {
+		cert, certErr := tls.LoadX509KeyPair(d.Attr.HTTPClientCert, d.Attr.HTTPClientKey)
+		if certErr != nil {
+			return nil, fmt.Errorf("httpClient: client cert: %v", certErr)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	dial, dialErr := d.dialer(logger, repository, opt)
+	if dialErr != nil {
+		return nil, fmt.Errorf("httpClient: %v", dialErr)
+	}
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(addr, d.Attr.ReadTimeout)
+		},
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   d.Attr.ReadTimeout,
+		ResponseHeaderTimeout: d.Attr.CommandReadTimeout,
+		DisableKeepAlives:     true,
+	}
+
+	return &http.Client{Transport: transport, Timeout: d.Attr.CommandMatchTimeout}, nil
+}
+
+func (d *Device) httpGet(client *http.Client, u string) ([]byte, error) {
+
+	req, reqErr := http.NewRequest("GET", u, nil)
+	if reqErr != nil {
+		return nil, reqErr
+	}
+
+	for k, v := range d.Attr.HTTPHeaders {
+		req.Header.Set(k, v)
+	}
+
+	switch d.Attr.HTTPAuth {
+	case "none":
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+d.LoginPassword)
+	default:
+		if d.LoginUser != "" {
+			req.SetBasicAuth(d.LoginUser, d.LoginPassword)
+		}
+	}
+
+	resp, getErr := client.Do(req)
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer resp.Body.Close()
+
+	body, readErr := readLimit(resp.Body, httpMaxBodySize)
+	if readErr != nil {
+		return nil, fmt.Errorf("body: %v", readErr)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("http status: %s", resp.Status)
+	}
+
+	if d.Attr.HTTPPrettyJSON && json.Valid(body) {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, body, "", "  "); err == nil {
+			buf.WriteByte('\n')
+			body = buf.Bytes()
+		}
+	}
+
+	return body, nil
 }
@@ -1,13 +1,18 @@
 package dev
 
 import (
+	"bytes"
+	"encoding/pem"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"testing"
 
 	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
 	"github.com/udhos/jazigo/temp"
 )
 
@@ -29,7 +34,9 @@ func TestHTTP1(t *testing.T) {
 	opt := conf.NewOptions()
 	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
 	RegisterModels(logger, tab)
-	CreateDevice(tab, logger, "http", "lab1", "localhost"+addr, "", "", "", "", false, nil)
+	CreateDevice(tab, logger, "http", "lab1", "localhost"+addr, "", "", "", "", false, nil) // baseline config: default transports
+	CreateDevice(tab, logger, "http", "lab2", "localhost"+addr, "tcp", "", "", "", false, nil)
+	CreateDevice(tab, logger, "http", "lab3", "localhost"+addr, "telnet", "", "", "", false, nil)
 
 	repo := temp.MakeTempRepo()
 	defer temp.CleanupTempRepo()
@@ -38,7 +45,7 @@ func TestHTTP1(t *testing.T) {
 	errlogPrefix := filepath.Join(repo, "errlog_test.")
 	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
 	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
-	if good != 1 || bad != 0 || skip != 0 {
+	if good != 3 || bad != 0 || skip != 0 {
 		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
 	}
 
@@ -77,3 +84,105 @@ func spawnServerHTTP(t *testing.T, addr string) (*testServer, error) {
 func rootHandler(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, "hello web client\n")
 }
+
+func TestREST(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus API server
+	m := http.NewServeMux()
+	m.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/api/config", http.StatusMovedPermanently)
+	})
+	m.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token1" || r.Header.Get("Accept") != "application/yang-data+json" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, `{"system":{"hostname":"lab1"}}`)
+	})
+	m.HandleFunc("/api/text", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hostname lab1\n")
+	})
+	s := httptest.NewTLSServer(m)
+	defer s.Close()
+
+	caPath := filepath.Join(repo, "ca.pem")
+	if err := ioutil.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw}), 0600); err != nil {
+		t.Fatalf("write CA cert: %v", err)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "rest", "lab1", s.Listener.Addr().String(), "https", "", "token1", "", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	d.Attr.URLList = []string{"/old", "api/text"}
+	d.Attr.HTTPAuth = "bearer"
+	d.Attr.HTTPHeaders = map[string]string{"Accept": "application/yang-data+json"}
+	d.Attr.HTTPCACert = caPath
+	tab.UpdateDevice(d)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"{\n  \"system\": {\n    \"hostname\": \"lab1\"\n  }\n}\n", "hostname lab1\n"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+}
+
+func TestRESTStatus(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus API server
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "lab" || pass != "pass" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	}))
+	defer s.Close()
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "rest", "good", s.Listener.Addr().String(), "http", "lab", "pass", "", false, nil)
+	CreateDevice(tab, logger, "rest", "bad", s.Listener.Addr().String(), "http", "lab", "wrong", "", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 1 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+}
@@ -41,6 +41,8 @@ func registerModelHuaweiVRP(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 15 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 25 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `##[%s]`
+	a.LineFilter = "huawei-vrp" // line filter name - applied to every saved line
+	a.MaskRules = "huawei"
 
 	m := &Model{name: "huawei-vrp"}
 	m.defaultAttr = a
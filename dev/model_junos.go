@@ -26,6 +26,8 @@ func registerModelJunOS(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'sh run'
 	a.CommandMatchTimeout = 30 * time.Second // larger timeout for slow 'sh run'
 	a.QuoteSentCommandsFormat = `##[%s]`
+	a.LineFilter = "junos" // line filter name - applied to every saved line
+	a.MaskRules = "junos"
 	a.S3ContentType = "detect"
 
 	m := &Model{name: "junos"}
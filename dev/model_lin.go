@@ -26,6 +26,7 @@ func registerModelLinux(logger hasPrintf, t *DeviceTable) {
 	a.CommandReadTimeout = 10 * time.Second
 	a.CommandMatchTimeout = 10 * time.Second
 	a.QuoteSentCommandsFormat = `##[%s]`
+	a.LineFilter = "linux" // line filter name - applied to every saved line
 
 	m := &Model{name: "linux"}
 	m.defaultAttr = a
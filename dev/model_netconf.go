@@ -0,0 +1,52 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+// netconfGetConfig retrieves the running configuration as XML.
+const netconfGetConfig = "<get-config><source><running/></source></get-config>"
+
+func netconfAttr() conf.DevAttributes {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = false
+	a.NeedEnabledMode = false
+	a.NeedPagingOff = false
+	a.DisabledPromptPattern = `</(\w+:)?rpc-reply>\s*$` // netconf transport delivers one reply per command
+	a.EnabledPromptPattern = `</(\w+:)?rpc-reply>\s*$`
+	a.CommandList = []string{netconfGetConfig}
+	a.SupressAutoLF = true
+	a.KeepControlChars = true
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 20 * time.Second  // larger timeout for large configs
+	a.CommandMatchTimeout = 60 * time.Second // larger timeout for large configs
+	a.QuoteSentCommandsFormat = `<!-- %s -->`
+	a.S3ContentType = "application/xml"
+
+	return a
+}
+
+func registerModelJunOSNetconf(logger hasPrintf, t *DeviceTable) {
+	a := netconfAttr()
+
+	m := &Model{name: "junos-netconf"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelJunOSNetconf: %v", err)
+	}
+}
+
+func registerModelCiscoIOSXRNetconf(logger hasPrintf, t *DeviceTable) {
+	a := netconfAttr()
+
+	m := &Model{name: "iosxr-netconf"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelCiscoIOSXRNetconf: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package dev
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestNetconfBase10(t *testing.T) {
+	testNetconf(t, ":2001", "junos-netconf", false, false)
+}
+
+func TestNetconfBase11(t *testing.T) {
+	testNetconf(t, ":2002", "iosxr-netconf", true, false)
+}
+
+func TestNetconfRPCError(t *testing.T) {
+	testNetconf(t, ":2004", "junos-netconf", true, true)
+}
+
+func testNetconf(t *testing.T, addr, model string, chunked, rpcError bool) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() != "lab" || string(pass) != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return nil, nil
+		},
+	}
+	handler := func(t *testing.T, c ssh.Channel) {
+		handleConnectionNetconf(t, c, chunked, rpcError)
+	}
+	s, listenErr := spawnServerSSH(t, addr, config, handler)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus NETCONF server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, model, "lab1", "localhost"+addr, "netconf", "lab", "pass", "", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	expectGood := 1
+	if rpcError {
+		expectGood = 0
+	}
+	if good != expectGood || bad != 1-expectGood || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	if expectGood < 1 {
+		if _, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger); lastErr == nil {
+			t.Errorf("rpc-error reply saved as config")
+		}
+		return
+	}
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	if !bytes.Contains(saved, []byte(netconfTestConfig)) {
+		t.Errorf("config not found in saved file: %q", saved)
+	}
+	if bytes.Contains(saved, []byte("<?xml")) || bytes.Contains(saved, []byte(netconfEOM)) || bytes.Contains(saved, []byte("\n##\n")) {
+		t.Errorf("framing found in saved file: %q", saved)
+	}
+}
+
+func TestNetconfBadHello(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	handlerDone := make(chan struct{})
+	handler := func(t *testing.T, c ssh.Channel) {
+		defer close(handlerDone)
+		defer c.Close()
+
+		// hello lacking base capability
+		fmt.Fprint(c, `<?xml version="1.0" encoding="UTF-8"?><hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities></capabilities><session-id>7</session-id></hello>`+netconfEOM)
+
+		codec := &netconfCodec{r: bufio.NewReader(c), w: c}
+		if _, err := codec.readMessage(); err != nil {
+			t.Errorf("handler: read hello: %v", err)
+			return
+		}
+
+		// session was not established, then client must not send rpc
+		if rpc, err := codec.readMessage(); err == nil {
+			t.Errorf("handler: unexpected rpc after failed hello: %q", rpc)
+		}
+	}
+	s, listenErr := spawnServerSSH(t, ":2003", config, handler)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus NETCONF server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "junos-netconf", "lab1", "localhost:2003", "netconf", "lab", "pass", "", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 0 || bad != 1 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	<-handlerDone // wait handler check
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+}
+
+const netconfTestConfig = "<configuration><system><host-name>lab1</host-name></system></configuration>"
+
+// handleConnectionNetconf: bogus NETCONF server
+func handleConnectionNetconf(t *testing.T, c ssh.Channel, chunked, rpcError bool) {
+	defer c.Close()
+
+	capabilities := "<capability>urn:ietf:params:netconf:base:1.0</capability>"
+	if chunked {
+		capabilities += "<capability>urn:ietf:params:netconf:base:1.1</capability>"
+	}
+	fmt.Fprintf(c, `<?xml version="1.0" encoding="UTF-8"?><hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>%s</capabilities><session-id>7</session-id></hello>]]>]]>`, capabilities)
+
+	codec := &netconfCodec{r: bufio.NewReader(c), w: c}
+
+	hello, helloErr := codec.readMessage()
+	if helloErr != nil {
+		t.Errorf("handleConnectionNetconf: read hello: %v", helloErr)
+		return
+	}
+	if !bytes.Contains(hello, []byte(netconfBase11)) {
+		t.Errorf("handleConnectionNetconf: client lacks base:1.1: %q", hello)
+	}
+
+	codec.chunked = chunked
+
+	for {
+		rpc, readErr := codec.readMessage()
+		if readErr != nil {
+			t.Logf("handleConnectionNetconf: read rpc: %v", readErr)
+			return
+		}
+
+		var reply string
+		switch {
+		case rpcError && bytes.Contains(rpc, []byte("<get-config>")):
+			reply = `<?xml version="1.0" encoding="UTF-8"?>
+<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><rpc-error><error-type>application</error-type><error-tag>access-denied</error-tag><error-severity>error</error-severity><error-message>permission denied</error-message></rpc-error></rpc-reply>`
+		case bytes.Contains(rpc, []byte("<get-config><source><running/></source></get-config>")):
+			reply = `<?xml version="1.0" encoding="UTF-8"?>
+<rpc-reply message-id="1" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><data>` + netconfTestConfig + `</data></rpc-reply>`
+		case bytes.Contains(rpc, []byte("<close-session/>")):
+			reply = `<rpc-reply message-id="2" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><ok/></rpc-reply>`
+		default:
+			t.Errorf("handleConnectionNetconf: unexpected rpc: %q", rpc)
+			return
+		}
+
+		if chunked {
+			// split reply into two chunks
+			half := len(reply) / 2
+			fmt.Fprintf(c, "\n#%d\n%s\n#%d\n%s\n##\n", half, reply[:half], len(reply)-half, reply[half:])
+		} else {
+			fmt.Fprint(c, reply+netconfEOM)
+		}
+
+		if strings.Contains(reply, "<ok/>") {
+			return // session closed
+		}
+	}
+}
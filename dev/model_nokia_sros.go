@@ -0,0 +1,34 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func registerModelNokiaSROS(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = false
+	a.NeedPagingOff = true
+	a.UsernamePromptPattern = `Login:\s*$`
+	a.PasswordPromptPattern = `Password:\s*$`
+	a.DisabledPromptPattern = `\S+#\s*$` // A:router1# *A:router1# (unsaved changes)
+	a.EnabledPromptPattern = `\S+#\s*$`
+	a.CommandList = []string{"show version", "admin display-config"}
+	a.DisablePagerCommand = "environment no more"
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 30 * time.Second  // larger timeout for slow 'admin display-config'
+	a.CommandMatchTimeout = 60 * time.Second // larger timeout for slow 'admin display-config'
+	a.QuoteSentCommandsFormat = `#[%s]`
+	a.LineFilter = "nokia-sros" // line filter name - applied to every saved line
+
+	m := &Model{name: "nokia-sros"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelNokiaSROS: %v", err)
+	}
+}
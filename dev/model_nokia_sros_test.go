@@ -0,0 +1,171 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestNokiaSROS(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerNokiaSROS(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus NokiaSROS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "nokia-sros", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"TiMOS-C-20.10.R1", `name "router1"`} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"# Generated", "# Finished"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerNokiaSROS(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopNokiaSROS(t, s, handleConnectionNokiaSROS)
+
+	return s, nil
+}
+
+func acceptLoopNokiaSROS(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopNokiaSROS: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+const nokiaSROSShowVersion = `TiMOS-C-20.10.R1 cpm/hops64 Nokia 7750 SR Copyright (c) 2000-2020 Nokia.
+All rights reserved. All use subject to applicable license agreements.
+`
+
+const nokiaSROSDisplayConfig = `# TiMOS-C-20.10.R1 cpm/hops64 Nokia 7750 SR Copyright (c) 2000-2020 Nokia.
+# Generated THU FEB 11 15:45:43 2016 UTC
+
+exit all
+configure
+    system
+        name "router1"
+    exit
+exit all
+
+# Finished THU FEB 11 15:45:44 2016 UTC
+`
+
+// handleConnectionNokiaSROS: bogus Nokia 7750 classic CLI
+func handleConnectionNokiaSROS(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Bogus NokiaSROS server\n\nLogin: ", "\nPassword: "} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionNokiaSROS: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionNokiaSROS: read login error: %v", err)
+			return
+		}
+	}
+
+	for {
+		// send command prompt
+		if _, err := c.Write([]byte("\n*A:router1# ")); err != nil {
+			t.Logf("handleConnectionNokiaSROS: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionNokiaSROS: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch cmd {
+		case "":
+		case "logout":
+			return
+		case "environment no more":
+		case "show version":
+			out = nokiaSROSShowVersion
+		case "admin display-config":
+			out = nokiaSROSDisplayConfig
+		default:
+			out = "Error: Bad command."
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionNokiaSROS: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
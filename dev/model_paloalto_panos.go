@@ -0,0 +1,34 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func registerModelPaloAltoPANOS(logger hasPrintf, t *DeviceTable) {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = false
+	a.NeedPagingOff = true
+	a.UsernamePromptPattern = `login( as)?:\s*$`
+	a.PasswordPromptPattern = `Password:\s*$`
+	a.DisabledPromptPattern = `\S+@\S+>\s*$` // admin@PA-220>
+	// setup command "set cli config-output-format set" is dropped from saved output by line filter
+	a.CommandList = []string{"set cli config-output-format set", "show config running"}
+	a.DisablePagerCommand = "set cli pager off"
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 30 * time.Second  // larger timeout for slow 'show config running'
+	a.CommandMatchTimeout = 60 * time.Second // larger timeout for slow 'show config running'
+	a.QuoteSentCommandsFormat = `#[%s]`
+	a.LineFilter = "paloalto-panos" // line filter name - applied to every saved line
+
+	m := &Model{name: "paloalto-panos"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelPaloAltoPANOS: %v", err)
+	}
+}
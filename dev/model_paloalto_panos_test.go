@@ -0,0 +1,165 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestPaloAltoPANOS(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerPaloAltoPANOS(t, addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus PaloAltoPANOS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "paloalto-panos", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"set deviceconfig system hostname PA-220", "set network interface ethernet ethernet1/1 layer3"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"Invalid syntax", "config-output-format"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerPaloAltoPANOS(t *testing.T, addr string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopPaloAltoPANOS(t, s, handleConnectionPaloAltoPANOS)
+
+	return s, nil
+}
+
+func acceptLoopPaloAltoPANOS(t *testing.T, s *testServer, handler func(*testing.T, net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopPaloAltoPANOS: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn)
+	}
+
+	close(s.done)
+}
+
+const paloAltoPANOSShowConfigRunning = `set deviceconfig system hostname PA-220
+set network interface ethernet ethernet1/1 layer3 ip 10.0.0.1/24
+`
+
+// handleConnectionPaloAltoPANOS: bogus PAN-OS operational mode
+func handleConnectionPaloAltoPANOS(t *testing.T, c net.Conn) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Bogus PaloAltoPANOS server\nlogin as: ", "\nPassword: "} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionPaloAltoPANOS: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionPaloAltoPANOS: read login error: %v", err)
+			return
+		}
+	}
+
+	prompt := "\nadmin@PA-220> "
+	setFormat := false
+
+	for {
+		// send command prompt
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionPaloAltoPANOS: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionPaloAltoPANOS: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch cmd {
+		case "":
+		case "exit":
+			return
+		case "set cli pager off":
+		case "set cli config-output-format set":
+			setFormat = true
+		case "show config running":
+			if !setFormat {
+				out = "<config version=\"10.1.0\"></config>"
+				break
+			}
+			out = paloAltoPANOSShowConfigRunning
+		default:
+			out = "Invalid syntax."
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionPaloAltoPANOS: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+// pfSense and OPNsense keep the whole configuration in a single XML file.
+// Both models are fetched like the files model: see fetchFiles.
+
+func firewallXMLAttr(path string) conf.DevAttributes {
+	a := conf.NewDevAttr()
+
+	a.FileList = []string{path}
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 20 * time.Second
+	a.CommandMatchTimeout = 60 * time.Second // timeout for copying config.xml
+	a.QuoteSentCommandsFormat = `<!-- %s -->`
+
+	return a
+}
+
+func registerModelPfSense(logger hasPrintf, t *DeviceTable) {
+	m := &Model{name: "pfsense"}
+	m.defaultAttr = firewallXMLAttr("/cf/conf/config.xml")
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelPfSense: %v", err)
+	}
+}
+
+func registerModelOPNsense(logger hasPrintf, t *DeviceTable) {
+	m := &Model{name: "opnsense"}
+	m.defaultAttr = firewallXMLAttr("/conf/config.xml")
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelOPNsense: %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package dev
+
+import (
+	"testing"
+
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestPfSense(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	testFiles(t, repo, ":2003", "pfsense", "scp", handleConnectionSCP, nil, []string{scpTestContent})
+}
+
+func TestOPNsense(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	testFiles(t, repo, ":2004", "opnsense", "scp", handleConnectionSCP, nil, []string{scpTestContent})
+}
@@ -0,0 +1,53 @@
+package dev
+
+import (
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func vyosAttr() conf.DevAttributes {
+	a := conf.NewDevAttr()
+
+	a.NeedLoginChat = true
+	a.NeedEnabledMode = false
+	a.NeedPagingOff = true
+	a.UsernamePromptPattern = `login:\s*$`
+	a.PasswordPromptPattern = `Password:\s*$`
+	a.DisabledPromptPattern = `\S+@\S+:\S*\$\s*$` // vyos@vyos:~$
+	a.CommandList = []string{"show version", "show configuration commands"}
+	a.ReadTimeout = 10 * time.Second
+	a.MatchTimeout = 20 * time.Second
+	a.SendTimeout = 5 * time.Second
+	a.CommandReadTimeout = 20 * time.Second  // larger timeout for slow 'show configuration'
+	a.CommandMatchTimeout = 30 * time.Second // larger timeout for slow 'show configuration'
+	a.QuoteSentCommandsFormat = `#[%s]`
+	a.LineFilter = "vyos" // line filter name - applied to every saved line
+
+	return a
+}
+
+func registerModelVyOS(logger hasPrintf, t *DeviceTable) {
+	a := vyosAttr()
+
+	a.DisablePagerCommand = "set terminal length 0"
+
+	m := &Model{name: "vyos"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelVyOS: %v", err)
+	}
+}
+
+// registerModelEdgeOS registers Ubiquiti EdgeOS, a VyOS derivative.
+func registerModelEdgeOS(logger hasPrintf, t *DeviceTable) {
+	a := vyosAttr()
+
+	a.DisablePagerCommand = "terminal length 0"
+
+	m := &Model{name: "edgeos"}
+	m.defaultAttr = a
+	if err := t.SetModel(m, logger); err != nil {
+		logger.Printf("registerModelEdgeOS: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package dev
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestVyOS(t *testing.T) {
+	testVyOS(t, ":2001", "vyos", "set terminal length 0")
+}
+
+func TestEdgeOS(t *testing.T) {
+	testVyOS(t, ":2002", "edgeos", "terminal length 0")
+}
+
+func testVyOS(t *testing.T, addr, model, pagerCommand string) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	// launch bogus test server
+	s, listenErr := spawnServerVyOS(t, addr, pagerCommand)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus VyOS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, model, "lab1", "localhost"+addr, "telnet", "lab", "pass", "", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	for _, expected := range []string{"Version:          VyOS 1.3.0", "set system host-name 'vyos'"} {
+		if !bytes.Contains(saved, []byte(expected)) {
+			t.Errorf("missing %q in saved file: %q", expected, saved)
+		}
+	}
+	for _, unexpected := range []string{"Uptime:", "Invalid command"} {
+		if bytes.Contains(saved, []byte(unexpected)) {
+			t.Errorf("unexpected %q in saved file: %q", unexpected, saved)
+		}
+	}
+}
+
+func spawnServerVyOS(t *testing.T, addr, pagerCommand string) (*testServer, error) {
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go acceptLoopVyOS(t, s, handleConnectionVyOS, pagerCommand)
+
+	return s, nil
+}
+
+func acceptLoopVyOS(t *testing.T, s *testServer, handler func(*testing.T, net.Conn, string), pagerCommand string) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			t.Logf("acceptLoopVyOS: accept failure, exiting: %v", err)
+			break
+		}
+		go handler(t, conn, pagerCommand)
+	}
+
+	close(s.done)
+}
+
+const vyosShowVersion = `Version:          VyOS 1.3.0
+Release train:    equuleus
+
+Built by:         Sentrium S.L.
+Built on:         Sun 19 Dec 2021 13:42 UTC
+Uptime:           15:45:43 up 3 days,  2:05,  1 user,  load average: 0.00, 0.01, 0.05
+`
+
+const vyosShowConfigurationCommands = `set interfaces ethernet eth0 address 'dhcp'
+set interfaces loopback lo
+set system host-name 'vyos'
+set system login user vyos authentication encrypted-password '$6$xyz'
+`
+
+// handleConnectionVyOS: bogus VyOS operational mode
+func handleConnectionVyOS(t *testing.T, c net.Conn, pagerCommand string) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for _, prompt := range []string{"Welcome to VyOS\nvyos login: ", "\nPassword: "} {
+		if _, err := c.Write([]byte(prompt)); err != nil {
+			t.Logf("handleConnectionVyOS: send login prompt error: %v", err)
+			return
+		}
+		if _, err := c.Read(buf); err != nil {
+			t.Logf("handleConnectionVyOS: read login error: %v", err)
+			return
+		}
+	}
+
+	for {
+		// send command prompt
+		if _, err := c.Write([]byte("\nvyos@vyos:~$ ")); err != nil {
+			t.Logf("handleConnectionVyOS: send command prompt error: %v", err)
+			return
+		}
+
+		// consume command
+		n, readErr := c.Read(buf)
+		if readErr != nil {
+			if readErr != io.EOF {
+				t.Logf("handleConnectionVyOS: read command error: %v", readErr)
+			}
+			return
+		}
+
+		cmd := strings.TrimSpace(string(buf[:n]))
+
+		var out string
+
+		switch cmd {
+		case "":
+		case "exit":
+			return
+		case pagerCommand:
+		case "show version":
+			out = vyosShowVersion
+		case "show configuration commands":
+			out = vyosShowConfigurationCommands
+		default:
+			out = "\n  Invalid command: [" + cmd + "]\n"
+		}
+
+		if out != "" {
+			if _, err := c.Write([]byte("\n" + out)); err != nil {
+				t.Logf("handleConnectionVyOS: send output error: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package dev
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+const modelFileMaxSize = 1000000 // 1M
+
+var modelNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// modelFile is the YAML definition of a model.
+//
+// Example:
+//
+//	name: my-switch
+//	attr:
+//	  needloginchat: true
+//	  usernamepromptpattern: 'login:\s*$'
+//	  passwordpromptpattern: 'Password:\s*$'
+//	  disabledpromptpattern: '\S+>\s*$'
+//	  enabledpromptpattern: '\S+#\s*$'
+//	  commandlist: ["show version", "show running-config"]
+//	  readtimeout: 10s
+type modelFile struct {
+	Name string
+	Attr conf.DevAttributes
+}
+
+// LoadModels loads model definitions from YAML files (*.yml, *.yaml) in directory dir.
+// Previously loaded models are replaced, so LoadModels can be called again for reloading.
+// Invalid files are skipped and reported in the returned error.
+func LoadModels(logger hasPrintf, t *DeviceTable, dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	entries, dirErr := ioutil.ReadDir(dir)
+	if dirErr != nil {
+		if os.IsNotExist(dirErr) {
+			logger.Printf("LoadModels: models directory not found: %s", dir)
+			t.replaceLoadedModels(nil, logger)
+			return nil
+		}
+		return fmt.Errorf("LoadModels: %v", dirErr)
+	}
+
+	var names []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+
+	var list []*Model
+	var errs []string
+	seen := map[string]string{} // model name => file
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		m, loadErr := loadModelFile(path)
+		if loadErr != nil {
+			errs = append(errs, loadErr.Error())
+			continue
+		}
+		if first, found := seen[m.name]; found {
+			errs = append(errs, fmt.Sprintf("%s: model '%s' already defined in %s", path, m.name, first))
+			continue
+		}
+		seen[m.name] = path
+		list = append(list, m)
+	}
+
+	t.replaceLoadedModels(list, logger)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("LoadModels: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+func loadModelFile(path string) (*Model, error) {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return nil, statErr
+	}
+	if info.Size() > modelFileMaxSize {
+		return nil, fmt.Errorf("%s: file too large: %d", path, info.Size())
+	}
+
+	buf, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	mf := modelFile{Attr: conf.NewDevAttr()}
+	if err := yaml.UnmarshalStrict(buf, &mf); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if !modelNameRegexp.MatchString(mf.Name) {
+		return nil, fmt.Errorf("%s: bad model name: '%s'", path, mf.Name)
+	}
+
+	if err := validateModelAttr(&mf.Attr); err != nil {
+		return nil, fmt.Errorf("%s: model '%s': %v", path, mf.Name, err)
+	}
+
+	return &Model{name: mf.Name, defaultAttr: mf.Attr, file: path}, nil
+}
+
+// validateModelAttr checks patterns and fills in missing timeouts.
+func validateModelAttr(a *conf.DevAttributes) error {
+	patterns := []struct {
+		name    string
+		pattern string
+	}{
+		{"usernamepromptpattern", a.UsernamePromptPattern},
+		{"passwordpromptpattern", a.PasswordPromptPattern},
+		{"enablepasswordpromptpattern", a.EnablePasswordPromptPattern},
+		{"disabledpromptpattern", a.DisabledPromptPattern},
+		{"enabledpromptpattern", a.EnabledPromptPattern},
+		{"postloginpromptpattern", a.PostLoginPromptPattern},
+	}
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p.pattern); err != nil {
+			return fmt.Errorf("bad %s: %v", p.name, err)
+		}
+	}
+
+	if len(a.CommandList) < 1 && len(a.Dialog) < 1 && len(a.URLList) < 1 && len(a.FileList) < 1 {
+		return fmt.Errorf("empty commandlist")
+	}
+	if _, err := validateDialog(a.Dialog); err != nil {
+		return err
+	}
+	if err := validateArtifacts(a.Artifacts); err != nil {
+		return err
+	}
+	if err := ValidateHostKeyCheck(a.HostKeyCheck); err != nil {
+		return err
+	}
+	switch a.HTTPScheme {
+	case "", "http", "https":
+	default:
+		return fmt.Errorf("bad httpscheme: '%s'", a.HTTPScheme)
+	}
+	if a.NeedLoginChat && (a.UsernamePromptPattern == "" || a.PasswordPromptPattern == "") {
+		return fmt.Errorf("needloginchat requires usernamepromptpattern and passwordpromptpattern")
+	}
+	if a.NeedEnabledMode && a.EnableCommand == "" {
+		return fmt.Errorf("needenabledmode requires enablecommand")
+	}
+	if a.NeedPagingOff && a.DisablePagerCommand == "" {
+		return fmt.Errorf("needpagingoff requires disablepagercommand")
+	}
+
+	timeouts := []struct {
+		value *time.Duration
+		def   time.Duration
+	}{
+		{&a.ReadTimeout, 10 * time.Second},
+		{&a.MatchTimeout, 20 * time.Second},
+		{&a.SendTimeout, 5 * time.Second},
+		{&a.CommandReadTimeout, 20 * time.Second},
+		{&a.CommandMatchTimeout, 30 * time.Second},
+	}
+	for _, t := range timeouts {
+		if *t.value < 0 {
+			return fmt.Errorf("negative timeout: %s", *t.value)
+		}
+		if *t.value == 0 {
+			*t.value = t.def
+		}
+	}
+
+	return nil
+}
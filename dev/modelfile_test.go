@@ -0,0 +1,161 @@
+package dev
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
+)
+
+const modelFileTestIOS = `
+name: yaml-ios
+attr:
+  needloginchat: true
+  needenabledmode: true
+  needpagingoff: true
+  enablecommand: enable
+  usernamepromptpattern: 'Username:\s*$'
+  passwordpromptpattern: 'Password:\s*$'
+  enablepasswordpromptpattern: 'Password:\s*$'
+  disabledpromptpattern: '\S+>\s*$'
+  enabledpromptpattern: '\S+#\s*$'
+  commandlist: ["show ver", "show run"]
+  disablepagercommand: term len 0
+  commandmatchtimeout: 40s
+  quotesentcommandsformat: '!![%s]'
+`
+
+func writeModelFile(t *testing.T, dir, name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0640); err != nil {
+		t.Fatalf("write model file: %v", err)
+	}
+}
+
+func TestLoadModels(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	dir := filepath.Join(repo, "models")
+	if err := os.Mkdir(dir, 0750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	writeModelFile(t, dir, "a.yml", modelFileTestIOS)
+	writeModelFile(t, dir, "b.yaml", "name: yaml-other\nattr:\n  commandlist: [\"show conf\"]\n")
+	writeModelFile(t, dir, "c.yml", "name: yaml-ios\nattr:\n  commandlist: [\"dup\"]\n")                              // duplicate
+	writeModelFile(t, dir, "d.yml", "name: bad-regexp\nattr:\n  enabledpromptpattern: '('\n  commandlist: [\"x\"]\n") // bad pattern
+	writeModelFile(t, dir, "e.yml", "name: bad-field\nattr:\n  nosuchfield: true\n")                                  // strict
+	writeModelFile(t, dir, "f.yml", "name: cisco-ios\nattr:\n  commandlist: [\"x\"]\n")                               // conflicts with built-in
+	writeModelFile(t, dir, "g.txt", "ignored")
+
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	RegisterModels(logger, tab)
+	builtin := len(tab.ListModels())
+
+	err := LoadModels(logger, tab, dir)
+	if err == nil {
+		t.Errorf("LoadModels: expected error for bad files")
+	} else {
+		for _, f := range []string{"c.yml", "d.yml", "e.yml"} {
+			if !strings.Contains(err.Error(), f) {
+				t.Errorf("LoadModels: error should report %s: %v", f, err)
+			}
+		}
+	}
+
+	if n := len(tab.ListModels()); n != builtin+2 {
+		t.Errorf("models: expected=%d got=%d", builtin+2, n)
+	}
+
+	m, getErr := tab.GetModel("yaml-ios")
+	if getErr != nil {
+		t.Fatalf("GetModel: %v", getErr)
+	}
+	if m.defaultAttr.CommandMatchTimeout != 40*time.Second || m.defaultAttr.ReadTimeout != 10*time.Second {
+		t.Errorf("yaml-ios: unexpected timeouts: %v %v", m.defaultAttr.CommandMatchTimeout, m.defaultAttr.ReadTimeout)
+	}
+	if m, _ := tab.GetModel("cisco-ios"); m.file != "" {
+		t.Errorf("built-in cisco-ios replaced by %s", m.file)
+	}
+
+	// reload
+	os.Remove(filepath.Join(dir, "b.yaml"))
+	writeModelFile(t, dir, "h.yml", "name: yaml-new\nattr:\n  urllist: [\"/api/config\"]\n") // urllist replaces commandlist
+
+	LoadModels(logger, tab, dir)
+
+	if _, err := tab.GetModel("yaml-other"); err == nil {
+		t.Errorf("yaml-other should have been removed")
+	}
+	if _, err := tab.GetModel("yaml-new"); err != nil {
+		t.Errorf("yaml-new should have been loaded: %v", err)
+	}
+	if n := len(tab.ListModels()); n != builtin+2 {
+		t.Errorf("models after reload: expected=%d got=%d", builtin+2, n)
+	}
+}
+
+func TestLoadModelsFetch(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	dir := filepath.Join(repo, "models")
+	if err := os.Mkdir(dir, 0750); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeModelFile(t, dir, "ios.yml", modelFileTestIOS)
+
+	// launch bogus test server
+	addr := ":2001"
+	s, listenErr := spawnServerCiscoIOS(t, addr, optionsCiscoIOS{sendUsername: true, sendDisable: true, requestEnablePass: true})
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus CiscoIOS server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	if err := LoadModels(logger, tab, dir); err != nil {
+		t.Fatalf("LoadModels: %v", err)
+	}
+	CreateDevice(tab, logger, "yaml-ios", "lab1", "localhost"+addr, "telnet", "lab", "pass", "en", false, nil)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+
+	path, lastErr := store.FindLastConfig(DeviceFullPrefix(repo, "lab1"), logger)
+	if lastErr != nil {
+		t.Fatalf("FindLastConfig: %v", lastErr)
+	}
+	saved, readErr := store.FileRead(path, 1000000)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	if !bytes.Contains(saved, []byte(`!!["show run"]`)) {
+		t.Errorf("quoted command not found in saved file: %q", saved)
+	}
+}
@@ -0,0 +1,199 @@
+package dev
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	netconfBase10 = "urn:ietf:params:netconf:base:1.0"
+	netconfBase11 = "urn:ietf:params:netconf:base:1.1"
+	netconfNS     = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	netconfEOM    = "]]>]]>"  // end-of-message delimiter for base:1.0 framing
+	netconfMsgMax = 100000000 // 100M
+)
+
+const netconfHello = `<?xml version="1.0" encoding="UTF-8"?>
+<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">
+  <capabilities>
+    <capability>urn:ietf:params:netconf:base:1.0</capability>
+    <capability>urn:ietf:params:netconf:base:1.1</capability>
+  </capabilities>
+</hello>`
+
+type netconfServerHello struct {
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    string   `xml:"session-id"`
+}
+
+// netconfCodec implements NETCONF message framing (RFC 6242).
+// Framing starts as end-of-message (base:1.0) and switches to chunked (base:1.1)
+// after hello exchange, if both peers support base:1.1.
+type netconfCodec struct {
+	r       *bufio.Reader
+	w       io.Writer
+	chunked bool
+}
+
+func (c *netconfCodec) writeMessage(msg []byte) error {
+	var buf bytes.Buffer
+	if c.chunked {
+		if len(msg) > 0 {
+			fmt.Fprintf(&buf, "\n#%d\n", len(msg))
+			buf.Write(msg)
+		}
+		buf.WriteString("\n##\n")
+	} else {
+		buf.Write(msg)
+		buf.WriteString(netconfEOM)
+	}
+	_, err := c.w.Write(buf.Bytes())
+	return err
+}
+
+func (c *netconfCodec) readMessage() ([]byte, error) {
+	if c.chunked {
+		return c.readChunked()
+	}
+	return c.readEOM()
+}
+
+func (c *netconfCodec) readEOM() ([]byte, error) {
+	var msg []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return msg, err
+		}
+		msg = append(msg, b)
+		if b == '>' && bytes.HasSuffix(msg, []byte(netconfEOM)) {
+			return msg[:len(msg)-len(netconfEOM)], nil
+		}
+		if len(msg) > netconfMsgMax {
+			return nil, fmt.Errorf("netconf: message too large")
+		}
+	}
+}
+
+func (c *netconfCodec) readChunked() ([]byte, error) {
+	var msg []byte
+	for {
+		// chunk header: \n#<size>\n - or end-of-chunks: \n##\n
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, header); err != nil {
+			return msg, err
+		}
+		if header[0] != '\n' || header[1] != '#' {
+			return msg, fmt.Errorf("netconf: bad chunk header: %q", header)
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return msg, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "#" {
+			return msg, nil // end of chunks
+		}
+		size, sizeErr := strconv.ParseUint(line, 10, 32)
+		if sizeErr != nil || size < 1 {
+			return msg, fmt.Errorf("netconf: bad chunk size: %q", line)
+		}
+		if len(msg)+int(size) > netconfMsgMax {
+			return nil, fmt.Errorf("netconf: message too large")
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(c.r, chunk); err != nil {
+			return msg, err
+		}
+		msg = append(msg, chunk...)
+	}
+}
+
+// hello exchanges capabilities and selects framing.
+func (c *netconfCodec) hello() (*netconfServerHello, error) {
+	if err := c.writeMessage([]byte(netconfHello)); err != nil {
+		return nil, fmt.Errorf("netconf hello: send: %v", err)
+	}
+
+	msg, readErr := c.readMessage()
+	if readErr != nil {
+		return nil, fmt.Errorf("netconf hello: recv: %v", readErr)
+	}
+
+	var h netconfServerHello
+	if err := xml.Unmarshal(msg, &h); err != nil {
+		return nil, fmt.Errorf("netconf hello: parse: %v", err)
+	}
+
+	base10 := false
+	for _, capab := range h.Capabilities {
+		switch strings.TrimSpace(capab) {
+		case netconfBase11:
+			c.chunked = true
+		case netconfBase10:
+			base10 = true
+		}
+	}
+	if !c.chunked && !base10 {
+		return nil, fmt.Errorf("netconf hello: server lacks base capability: %v", h.Capabilities)
+	}
+
+	return &h, nil
+}
+
+// netconfRPC wraps an operation into an rpc element.
+// Full <rpc> messages are sent as is.
+func netconfRPC(msgID int, operation []byte) []byte {
+	op := bytes.TrimSpace(operation)
+	if bytes.HasPrefix(op, []byte("<rpc")) || bytes.HasPrefix(op, []byte("<?xml")) {
+		return op
+	}
+	return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<rpc message-id="%d" xmlns="%s">%s</rpc>`, msgID, netconfNS, op))
+}
+
+type netconfReply struct {
+	Errors []struct {
+		Tag      string `xml:"error-tag"`
+		Severity string `xml:"error-severity"`
+		Message  string `xml:"error-message"`
+	} `xml:"rpc-error"`
+}
+
+// netconfReplyError reports rpc-error elements of severity error found in a reply.
+// Warnings are ignored.
+func netconfReplyError(msg []byte) error {
+	if !bytes.Contains(msg, []byte("rpc-error")) {
+		return nil // skip parsing large configs
+	}
+	var reply netconfReply
+	if err := xml.Unmarshal(msg, &reply); err != nil {
+		return fmt.Errorf("netconf reply: parse: %v", err)
+	}
+	for _, e := range reply.Errors {
+		if strings.TrimSpace(e.Severity) == "warning" {
+			continue
+		}
+		return fmt.Errorf("netconf reply: rpc-error: tag=%s severity=%s message=%s", strings.TrimSpace(e.Tag), strings.TrimSpace(e.Severity), strings.TrimSpace(e.Message))
+	}
+	return nil
+}
+
+// netconfStripDeclaration removes the XML declaration from a reply,
+// so that replies can be concatenated into a single saved file.
+func netconfStripDeclaration(msg []byte) []byte {
+	m := bytes.TrimLeft(msg, " \t\r\n")
+	if !bytes.HasPrefix(m, []byte("<?xml")) {
+		return msg
+	}
+	end := bytes.Index(m, []byte("?>"))
+	if end < 0 {
+		return msg
+	}
+	return bytes.TrimLeft(m[end+2:], " \t\r\n")
+}
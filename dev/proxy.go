@@ -0,0 +1,224 @@
+package dev
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ProxyNone disables the global proxy for a device.
+const ProxyNone = "none"
+
+// proxyDialer creates a dialFunc for reaching hosts thru a proxy.
+// Supported proxy URLs: socks5://[user:pass@]host:port and http://[user:pass@]host:port (CONNECT).
+// The connection to the proxy itself is opened by forward.
+func proxyDialer(proxyURL string, forward dialFunc) (dialFunc, error) {
+	u, parseErr := url.Parse(proxyURL)
+	if parseErr != nil {
+		return nil, fmt.Errorf("proxyDialer: bad proxy URL '%s': %v", proxyURL, parseErr)
+	}
+
+	var handshake func(conn net.Conn, u *url.URL, hostPort string) error
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		handshake = proxySOCKS5
+		u.Host = forceHostPort(u.Host, "1080")
+	case "http":
+		handshake = proxyConnect
+		u.Host = forceHostPort(u.Host, "8080")
+	default:
+		return nil, fmt.Errorf("proxyDialer: unsupported proxy scheme '%s': %s", u.Scheme, proxyURL)
+	}
+
+	return func(hostPort string, timeout time.Duration) (net.Conn, error) {
+		conn, dialErr := forward(u.Host, timeout)
+		if dialErr != nil {
+			if _, keyErr := dialErr.(*hostKeyError); keyErr {
+				return nil, dialErr // jump host key rejected
+			}
+			return nil, fmt.Errorf("proxyDialer: proxy %s: %v", u.Host, dialErr)
+		}
+
+		conn.SetDeadline(time.Now().Add(timeout))
+
+		if err := handshake(conn, u, hostPort); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxyDialer: %s thru proxy %s: %v", hostPort, u.Host, err)
+		}
+
+		conn.SetDeadline(time.Time{}) // clear handshake deadline
+
+		return conn, nil
+	}, nil
+}
+
+// proxySOCKS5 performs the SOCKS5 handshake (RFC 1928), with optional username/password auth (RFC 1929).
+// The destination hostname is resolved by the proxy.
+func proxySOCKS5(conn net.Conn, u *url.URL, hostPort string) error {
+	host, portStr, splitErr := net.SplitHostPort(hostPort)
+	if splitErr != nil {
+		return splitErr
+	}
+	port, portErr := strconv.ParseUint(portStr, 10, 16)
+	if portErr != nil {
+		return fmt.Errorf("socks5: bad port '%s': %v", portStr, portErr)
+	}
+	if len(host) > 255 {
+		return fmt.Errorf("socks5: hostname too long: %s", host)
+	}
+
+	const (
+		socksVersion   = 5
+		authNone       = 0
+		authPassword   = 2
+		authNoAccept   = 0xff
+		cmdConnect     = 1
+		addrIPv4       = 1
+		addrDomainName = 3
+		addrIPv6       = 4
+	)
+
+	// method negotiation
+	methods := []byte{authNone}
+	if u.User != nil {
+		methods = append(methods, authPassword)
+	}
+	if _, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return fmt.Errorf("socks5: unexpected version: %d", reply[0])
+	}
+
+	switch reply[1] {
+	case authNone:
+	case authPassword:
+		if u.User == nil {
+			return fmt.Errorf("socks5: proxy requested password auth")
+		}
+		user := u.User.Username()
+		pass, _ := u.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return fmt.Errorf("socks5: username or password too long")
+		}
+		req := []byte{1, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(pass)))
+		req = append(req, pass...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("socks5: password auth rejected")
+		}
+	case authNoAccept:
+		return fmt.Errorf("socks5: no acceptable auth method")
+	default:
+		return fmt.Errorf("socks5: unexpected auth method: %d", reply[1])
+	}
+
+	// connect request
+	req := []byte{socksVersion, cmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(req, addrDomainName, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, addrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, addrIPv6)
+		req = append(req, ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("socks5: connect failed: reply code %d", head[1])
+	}
+
+	// discard bound address
+	var skip int
+	switch head[3] {
+	case addrIPv4:
+		skip = net.IPv4len
+	case addrIPv6:
+		skip = net.IPv6len
+	case addrDomainName:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return err
+		}
+		skip = int(size[0])
+	default:
+		return fmt.Errorf("socks5: unexpected address type: %d", head[3])
+	}
+	if _, err := io.ReadFull(conn, make([]byte, skip+2)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// proxyConnect opens a tunnel with the HTTP CONNECT method.
+func proxyConnect(conn net.Conn, u *url.URL, hostPort string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: hostPort},
+		Host:   hostPort,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		cred := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// read byte by byte, so that no tunneled data is consumed
+	resp, readErr := http.ReadResponse(bufio.NewReaderSize(&oneByteReader{conn}, 16), req)
+	if readErr != nil {
+		return readErr
+	}
+
+	// body is left alone: after 200 the connection carries the tunnel
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http connect: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// oneByteReader prevents bufio from reading past the proxy response header.
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return o.r.Read(b)
+}
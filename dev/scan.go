@@ -120,7 +120,7 @@ func Scan(tab DeviceUpdater, devices []*Device, logger hasPrintf, opt *conf.AppC
 	return success, deviceCount - success, skipped + deleted
 }
 
-func updateDeviceStatus(tab DeviceUpdater, devID string, good bool, last time.Time, elapsed time.Duration, logger hasPrintf, holdtime time.Duration) {
+func updateDeviceStatus(tab DeviceUpdater, devID string, good bool, last time.Time, elapsed time.Duration, hostKey *hostKeyError, logger hasPrintf, holdtime time.Duration) {
 	d, getErr := tab.GetDevice(devID)
 	if getErr != nil {
 		logger.Printf("updateDeviceStatus: '%s' not found: %v", devID, getErr)
@@ -133,6 +133,7 @@ func updateDeviceStatus(tab DeviceUpdater, devID string, good bool, last time.Ti
 	d.lastTry = last
 	d.lastElapsed = elapsed
 	d.lastStatus = good
+	d.hostKeyPending = hostKey
 	if d.lastStatus {
 		d.lastSuccess = d.lastTry
 	}
@@ -0,0 +1,239 @@
+package dev
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestSSHPublicKey(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	pub, priv, genErr := ed25519.GenerateKey(rand.Reader)
+	if genErr != nil {
+		t.Fatalf("generate key: %v", genErr)
+	}
+	block, marshalErr := ssh.MarshalPrivateKeyWithPassphrase(priv, "", []byte("secret"))
+	if marshalErr != nil {
+		t.Fatalf("marshal key: %v", marshalErr)
+	}
+	keyPath := filepath.Join(repo, "id_test")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	authorized, _ := ssh.NewPublicKey(pub)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+
+	testSSHLogin(t, repo, ":2001", config, func(c *conf.DevConfig) {
+		c.SSHKeyPaths = []string{keyPath}
+		c.SSHKeyPassphrase = "secret"
+	})
+}
+
+func TestSSHKeyboardInteractive(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	config := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 1 || answers[0] != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return nil, nil
+		},
+	}
+
+	testSSHLogin(t, repo, ":2002", config, func(c *conf.DevConfig) {
+		c.SSHAuth = "password,keyboard-interactive"
+	})
+}
+
+func testSSHLogin(t *testing.T, repo, addr string, config *ssh.ServerConfig, setup func(*conf.DevConfig)) {
+
+	// launch bogus test server
+	s, listenErr := spawnServerSSH(t, addr, config, handleConnectionShell)
+	if listenErr != nil {
+		t.Fatalf("could not spawn bogus SSH server: %v", listenErr)
+	}
+
+	// run client test
+	logger := &testLogger{t}
+	tab := NewDeviceTable()
+	opt := conf.NewOptions()
+	opt.Set(&conf.AppConfig{MaxConcurrency: 3, MaxConfigFiles: 10})
+	RegisterModels(logger, tab)
+	CreateDevice(tab, logger, "linux", "lab1", "localhost"+addr, "ssh", "lab", "pass", "", false, nil)
+	d, _ := tab.GetDevice("lab1")
+	setup(&d.DevConfig)
+	tab.UpdateDevice(d)
+
+	requestCh := make(chan FetchRequest)
+	errlogPrefix := filepath.Join(repo, "errlog_test.")
+	go Spawner(tab, logger, requestCh, repo, errlogPrefix, opt, NewFilterTable(logger))
+	good, bad, skip := Scan(tab, tab.ListDevices(), logger, opt.Get(), requestCh)
+	if good != 1 || bad != 0 || skip != 0 {
+		t.Errorf("good=%d bad=%d skip=%d", good, bad, skip)
+	}
+
+	close(requestCh) // shutdown Spawner - we might exit first though
+
+	s.close() // shutdown server
+
+	<-s.done // wait termination of accept loop goroutine
+}
+
+func spawnServerSSH(t *testing.T, addr string, config *ssh.ServerConfig, handler func(*testing.T, ssh.Channel)) (*testServer, error) {
+
+	_, hostPriv, genErr := ed25519.GenerateKey(rand.Reader)
+	if genErr != nil {
+		return nil, genErr
+	}
+	hostKey, signerErr := ssh.NewSignerFromKey(hostPriv)
+	if signerErr != nil {
+		return nil, signerErr
+	}
+	config.AddHostKey(hostKey)
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &testServer{listener: ln, done: make(chan int)}
+
+	go func() {
+		for {
+			conn, acceptErr := ln.Accept()
+			if acceptErr != nil {
+				t.Logf("spawnServerSSH: accept failure, exiting: %v", acceptErr)
+				break
+			}
+			go serveSSH(t, conn, config, handler)
+		}
+		close(s.done)
+	}()
+
+	return s, nil
+}
+
+func serveSSH(t *testing.T, conn net.Conn, config *ssh.ServerConfig, handler func(*testing.T, ssh.Channel)) {
+	defer conn.Close()
+
+	_, chans, reqs, handshakeErr := ssh.NewServerConn(conn, config)
+	if handshakeErr != nil {
+		t.Logf("serveSSH: handshake: %v", handshakeErr)
+		return
+	}
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() == "direct-tcpip" {
+			go forwardSSH(t, newChannel)
+			continue
+		}
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, acceptErr := newChannel.Accept()
+		if acceptErr != nil {
+			t.Logf("serveSSH: accept channel: %v", acceptErr)
+			return
+		}
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				req.Reply(req.Type == "pty-req" || req.Type == "shell" || req.Type == "subsystem" || req.Type == "exec", nil)
+			}
+		}(requests)
+		go handler(t, channel)
+	}
+}
+
+// handleConnectionShell: bogus unix shell answering every command
+func handleConnectionShell(t *testing.T, c ssh.Channel) {
+	defer c.Close()
+
+	buf := make([]byte, 1000)
+
+	for {
+		if _, err := c.Write([]byte("\nlab$ ")); err != nil {
+			t.Logf("handleConnectionShell: send prompt error: %v", err)
+			return
+		}
+
+		n, err := c.Read(buf)
+		if err != nil {
+			return // peer closed connection
+		}
+
+		if _, err := c.Write([]byte(fmt.Sprintf("\noutput for %q", bytes.TrimSpace(buf[:n])))); err != nil {
+			t.Logf("handleConnectionShell: send output error: %v", err)
+			return
+		}
+	}
+}
+
+// forwardSSH: bogus bastion forwarding a direct-tcpip channel
+func forwardSSH(t *testing.T, newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	conn, dialErr := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if dialErr != nil {
+		newChannel.Reject(ssh.ConnectionFailed, dialErr.Error())
+		return
+	}
+	defer conn.Close()
+
+	channel, requests, acceptErr := newChannel.Accept()
+	if acceptErr != nil {
+		t.Logf("forwardSSH: accept channel: %v", acceptErr)
+		return
+	}
+	defer channel.Close()
+
+	go ssh.DiscardRequests(requests)
+
+	go func() {
+		io.Copy(conn, channel)
+		conn.Close()
+	}()
+	io.Copy(channel, conn)
+}
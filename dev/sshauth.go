@@ -0,0 +1,130 @@
+package dev
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// SSH authentication methods.
+const (
+	SSHAuthPublicKey           = "publickey"
+	SSHAuthAgent               = "agent"
+	SSHAuthPassword            = "password"
+	SSHAuthKeyboardInteractive = "keyboard-interactive"
+)
+
+// sshAuthDefault is the authentication order used when the device does not specify one.
+const sshAuthDefault = "publickey,agent,password,keyboard-interactive"
+
+// sshAuth holds device settings for ssh authentication.
+type sshAuth struct {
+	methods     string   // comma-separated list of methods, in order
+	keyPaths    []string // private key files
+	passphrase  string   // passphrase for encrypted private keys
+	agentSocket string   // ssh-agent unix socket
+}
+
+// sshAuthMethods builds the list of ssh.AuthMethod for a device.
+// The agent connection, if any, must be closed by the caller after the handshake.
+func sshAuthMethods(logger hasPrintf, devLabel, pass string, auth sshAuth) ([]ssh.AuthMethod, net.Conn, error) {
+
+	order := auth.methods
+	if order == "" {
+		order = sshAuthDefault
+	}
+
+	var methods []ssh.AuthMethod
+	var signers []ssh.Signer
+	var agentConn net.Conn
+	publicKeyAdded := false
+
+	// publickey and agent share the same ssh method name, hence a single callback,
+	// otherwise the ssh client would skip the second one.
+	addPublicKey := func() {
+		if publicKeyAdded {
+			return
+		}
+		publicKeyAdded = true
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			return signers, nil
+		}))
+	}
+
+	for _, m := range strings.Split(order, ",") {
+		switch strings.TrimSpace(m) {
+		case SSHAuthPublicKey:
+			if len(auth.keyPaths) < 1 {
+				continue
+			}
+			for _, path := range auth.keyPaths {
+				s, keyErr := sshLoadKey(path, auth.passphrase)
+				if keyErr != nil {
+					if agentConn != nil {
+						agentConn.Close()
+					}
+					return nil, nil, fmt.Errorf("sshAuthMethods: %s: %v", devLabel, keyErr)
+				}
+				signers = append(signers, s)
+			}
+			addPublicKey()
+		case SSHAuthAgent:
+			if auth.agentSocket == "" || agentConn != nil {
+				continue
+			}
+			socket := os.ExpandEnv(auth.agentSocket)
+			conn, dialErr := net.Dial("unix", socket)
+			if dialErr != nil {
+				logger.Printf("sshAuthMethods: %s: agent socket '%s': %v", devLabel, socket, dialErr)
+				continue
+			}
+			agentConn = conn
+			agentSigners, agentErr := agent.NewClient(conn).Signers()
+			if agentErr != nil {
+				logger.Printf("sshAuthMethods: %s: agent signers: %v", devLabel, agentErr)
+				continue
+			}
+			signers = append(signers, agentSigners...)
+			addPublicKey()
+		case SSHAuthPassword:
+			methods = append(methods, ssh.Password(pass))
+		case SSHAuthKeyboardInteractive:
+			methods = append(methods, ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+				// answer every question with the login password
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = pass
+				}
+				return answers, nil
+			}))
+		case "":
+		default:
+			logger.Printf("sshAuthMethods: %s: ignoring unknown method '%s'", devLabel, m)
+		}
+	}
+
+	if len(methods) < 1 {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, nil, fmt.Errorf("sshAuthMethods: %s: no usable authentication method: [%s]", devLabel, order)
+	}
+
+	return methods, agentConn, nil
+}
+
+func sshLoadKey(path, passphrase string) (ssh.Signer, error) {
+	buf, readErr := ioutil.ReadFile(path)
+	if readErr != nil {
+		return nil, readErr
+	}
+	if passphrase != "" {
+		return ssh.ParsePrivateKeyWithPassphrase(buf, []byte(passphrase))
+	}
+	return ssh.ParsePrivateKey(buf)
+}
@@ -57,6 +57,29 @@ func (t *DeviceTable) SetModel(m *Model, logger hasPrintf) error {
 	return nil
 }
 
+// replaceLoadedModels replaces all models loaded from files with a new set.
+// Built-in models are never replaced.
+func (t *DeviceTable) replaceLoadedModels(list []*Model, logger hasPrintf) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for name, m := range t.models {
+		if m.file != "" {
+			delete(t.models, name)
+		}
+	}
+
+	for _, m := range list {
+		if _, found := t.models[m.name]; found {
+			logger.Printf("DeviceTable.replaceLoadedModels: %s: model '%s' conflicts with built-in model", m.file, m.name)
+			continue
+		}
+		logger.Printf("DeviceTable.replaceLoadedModels: registering model: '%s' from %s", m.name, m.file)
+		m1 := *m // force copy data
+		t.models[m1.name] = &m1
+	}
+}
+
 // GetDevice finds a device in the device table.
 func (t *DeviceTable) GetDevice(id string) (*Device, error) {
 	t.lock.RLock()
@@ -1,10 +1,13 @@
 package dev
 
 import (
+	"bytes"
 	"time"
 )
 
 const (
+	cmdSE   = 240
+	cmdSB   = 250
 	cmdWill = 251
 	cmdWont = 252
 	cmdDo   = 253
@@ -13,14 +16,43 @@ const (
 
 	optEcho           = 1
 	optSupressGoAhead = 3
+	optTerminalType   = 24
+	optNAWS           = 31
 	optLinemode       = 34
+
+	ttypeIS   = 0
+	ttypeSEND = 1
+)
+
+const (
+	telnetTerminalType = "VT100"
+	telnetWindowWidth  = 200
+	telnetWindowHeight = 0 // zero disables paging on most devices
+	telnetSubnegMax    = 1000
 )
 
-func shift(b []byte, size, offset int) int {
-	copy(b, b[offset:size])
-	return size - offset
+// telnetLocalOptions are options we agree to perform when the server sends DO.
+var telnetLocalOptions = map[byte]bool{
+	optSupressGoAhead: true,
+	optTerminalType:   true,
+	optNAWS:           true,
+}
+
+// telnetRemoteOptions are options we agree to let the server perform when it sends WILL.
+var telnetRemoteOptions = map[byte]bool{
+	optEcho:           true,
+	optSupressGoAhead: true,
 }
 
+// parser states
+const (
+	telnetData = iota
+	telnetIAC
+	telnetOption // waiting option byte for WILL/WONT/DO/DONT
+	telnetSubneg
+	telnetSubnegIAC
+)
+
 type telnetNegotiationOnly struct{}
 
 var telnetNegOnly = telnetNegotiationOnly{}
@@ -29,44 +61,178 @@ func (e telnetNegotiationOnly) Error() string {
 	return "telnetNegotiationOnlyError"
 }
 
-func telnetNegotiation(buf []byte, n int, t transp, logger hasPrintf, debug bool) (int, error) {
+// telnetState is the telnet protocol state for a connection.
+// The state survives across reads, since commands may be split between reads.
+type telnetState struct {
+	state  int
+	verb   byte          // pending WILL/WONT/DO/DONT
+	subneg []byte        // pending subnegotiation
+	local  map[byte]bool // options enabled on our side
+	remote map[byte]bool // options enabled on server side
+	reply  bytes.Buffer  // responses to send back to server
+}
+
+func newTelnetState() *telnetState {
+	return &telnetState{local: map[byte]bool{}, remote: map[byte]bool{}}
+}
 
-	timeout := 5 * time.Second // FIXME??
-	hitNeg := false
+// telnetNegotiation strips telnet commands from buf[:n], returning the size of remaining data.
+// Responses to the server are sent thru t.
+func telnetNegotiation(s *telnetState, buf []byte, n int, t transp, logger hasPrintf, debug bool) (int, error) {
 
-	for {
-		if n < 3 {
-			break
-		}
-		if buf[0] != cmdIAC {
-			break // not IAC
-		}
+	size := s.parse(buf, n)
+
+	if s.reply.Len() > 0 {
 		if debug {
-			logger.Printf("telnetNegotiation: debug: FOUND telnet IAC")
+			logger.Printf("telnetNegotiation: debug: sending %q", s.reply.Bytes())
+		}
+		timeout := 5 * time.Second
+		if err := t.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return size, err
 		}
-		b1 := buf[1]
-		switch b1 {
-		case cmdDo, cmdDont:
-			opt := buf[2]
-			t.SetWriteDeadline(time.Now().Add(timeout)) // FIXME: handle error
-			t.Write([]byte{cmdIAC, cmdWont, opt})       // IAC WONT opt - FIXME: handle error
-			n = shift(buf, n, 3)
-			hitNeg = true
-			continue
-		case cmdWill, cmdWont:
-			opt := buf[2]
-			t.SetWriteDeadline(time.Now().Add(timeout)) // FIXME: handle error
-			t.Write([]byte{cmdIAC, cmdDont, opt})       // IAC DONT opt - FIXME: handle error
-			n = shift(buf, n, 3)
-			hitNeg = true
-			continue
+		_, err := t.Write(s.reply.Bytes())
+		s.reply.Reset()
+		if err != nil {
+			return size, err
 		}
-		break
 	}
 
-	if n == 0 && hitNeg {
+	if size == 0 && n > 0 {
 		return 0, telnetNegOnly
 	}
 
-	return n, nil
+	return size, nil
+}
+
+// parse removes telnet commands from buf[:n] in place, queuing responses.
+func (s *telnetState) parse(buf []byte, n int) int {
+	size := 0
+
+	for _, b := range buf[:n] {
+		switch s.state {
+		case telnetData:
+			if b == cmdIAC {
+				s.state = telnetIAC
+				continue
+			}
+			buf[size] = b
+			size++
+		case telnetIAC:
+			switch b {
+			case cmdIAC:
+				buf[size] = b // escaped 0xFF data byte
+				size++
+				s.state = telnetData
+			case cmdWill, cmdWont, cmdDo, cmdDont:
+				s.verb = b
+				s.state = telnetOption
+			case cmdSB:
+				s.subneg = s.subneg[:0]
+				s.state = telnetSubneg
+			default:
+				s.state = telnetData // NOP, GA, etc
+			}
+		case telnetOption:
+			s.option(s.verb, b)
+			s.state = telnetData
+		case telnetSubneg:
+			if b == cmdIAC {
+				s.state = telnetSubnegIAC
+				continue
+			}
+			if len(s.subneg) < telnetSubnegMax {
+				s.subneg = append(s.subneg, b)
+			}
+		case telnetSubnegIAC:
+			switch b {
+			case cmdSE:
+				s.subnegotiation(s.subneg)
+				s.state = telnetData
+			case cmdIAC:
+				if len(s.subneg) < telnetSubnegMax {
+					s.subneg = append(s.subneg, b)
+				}
+				s.state = telnetSubneg
+			default:
+				s.state = telnetSubneg // malformed, keep looking for IAC SE
+			}
+		}
+	}
+
+	return size
+}
+
+// option answers WILL/WONT/DO/DONT.
+// A request for the current state is not acknowledged, in order to avoid loops (RFC 854).
+func (s *telnetState) option(verb, opt byte) {
+	switch verb {
+	case cmdDo:
+		if s.local[opt] {
+			return
+		}
+		if !telnetLocalOptions[opt] {
+			s.send(cmdWont, opt)
+			return
+		}
+		s.local[opt] = true
+		s.send(cmdWill, opt)
+		if opt == optNAWS {
+			s.sendWindowSize()
+		}
+	case cmdDont:
+		if !s.local[opt] {
+			return
+		}
+		s.local[opt] = false
+		s.send(cmdWont, opt)
+	case cmdWill:
+		if s.remote[opt] {
+			return
+		}
+		if !telnetRemoteOptions[opt] {
+			s.send(cmdDont, opt)
+			return
+		}
+		s.remote[opt] = true
+		s.send(cmdDo, opt)
+	case cmdWont:
+		if !s.remote[opt] {
+			return
+		}
+		s.remote[opt] = false
+		s.send(cmdDont, opt)
+	}
+}
+
+func (s *telnetState) subnegotiation(sb []byte) {
+	if len(sb) < 1 {
+		return
+	}
+	switch sb[0] {
+	case optTerminalType:
+		if len(sb) > 1 && sb[1] == ttypeSEND && s.local[optTerminalType] {
+			s.reply.Write([]byte{cmdIAC, cmdSB, optTerminalType, ttypeIS})
+			s.reply.WriteString(telnetTerminalType)
+			s.reply.Write([]byte{cmdIAC, cmdSE})
+		}
+	}
+}
+
+func (s *telnetState) send(verb, opt byte) {
+	s.reply.Write([]byte{cmdIAC, verb, opt})
+}
+
+// sendWindowSize reports window size (RFC 1073).
+func (s *telnetState) sendWindowSize() {
+	s.reply.Write([]byte{cmdIAC, cmdSB, optNAWS})
+	s.reply.Write(telnetEscape([]byte{telnetWindowWidth >> 8, telnetWindowWidth & 0xff, telnetWindowHeight >> 8, telnetWindowHeight & 0xff}))
+	s.reply.Write([]byte{cmdIAC, cmdSE})
+}
+
+// telnetEscape doubles 0xFF bytes so that they are not taken as IAC.
+func telnetEscape(b []byte) []byte {
+	if bytes.IndexByte(b, cmdIAC) < 0 {
+		return b
+	}
+	return bytes.Replace(b, []byte{cmdIAC}, []byte{cmdIAC, cmdIAC}, -1)
 }
@@ -0,0 +1,130 @@
+package dev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTelnetParse(t *testing.T) {
+
+	input := []byte{'a', cmdIAC, cmdDo, optNAWS, 'b', cmdIAC, cmdIAC, 'c', cmdIAC, cmdWill, optEcho, cmdIAC, cmdDo, optLinemode,
+		cmdIAC, cmdSB, optTerminalType, ttypeSEND, cmdIAC, cmdSE, cmdIAC, cmdDo, optNAWS, 'd'}
+
+	expectedData := []byte{'a', 'b', cmdIAC, 'c', 'd'}
+	expectedReply := []byte{cmdIAC, cmdWill, optNAWS, cmdIAC, cmdSB, optNAWS, 0, telnetWindowWidth, 0, telnetWindowHeight, cmdIAC, cmdSE,
+		cmdIAC, cmdDo, optEcho, cmdIAC, cmdWont, optLinemode}
+
+	// feed input in chunks of every size, so that commands are split between reads
+	for chunk := 1; chunk <= len(input); chunk++ {
+		s := newTelnetState()
+		var data []byte
+		for i := 0; i < len(input); i += chunk {
+			end := i + chunk
+			if end > len(input) {
+				end = len(input)
+			}
+			buf := append([]byte{}, input[i:end]...)
+			n := s.parse(buf, len(buf))
+			data = append(data, buf[:n]...)
+		}
+		if !bytes.Equal(data, expectedData) {
+			t.Errorf("chunk=%d data: expected=%q got=%q", chunk, expectedData, data)
+		}
+		if !bytes.Equal(s.reply.Bytes(), expectedReply) {
+			t.Errorf("chunk=%d reply: expected=%q got=%q", chunk, expectedReply, s.reply.Bytes())
+		}
+	}
+}
+
+func TestTelnetServer(t *testing.T) {
+
+	addr := ":2001"
+	ln, listenErr := net.Listen("tcp", addr)
+	if listenErr != nil {
+		t.Fatalf("could not spawn scripted telnet server: %v", listenErr)
+	}
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, acceptErr := ln.Accept()
+		if acceptErr != nil {
+			serverErr <- acceptErr
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		serverErr <- scriptTelnet(conn, []telnetStep{
+			{send: []byte{cmdIAC, cmdDo, optTerminalType, cmdIAC, cmdDo, optNAWS}, expect: []byte{cmdIAC, cmdWill, optTerminalType, cmdIAC, cmdWill, optNAWS,
+				cmdIAC, cmdSB, optNAWS, 0, telnetWindowWidth, 0, telnetWindowHeight, cmdIAC, cmdSE}},
+			{send: []byte{cmdIAC, cmdSB, optTerminalType, ttypeSEND, cmdIAC, cmdSE}, expect: append(append([]byte{cmdIAC, cmdSB, optTerminalType, ttypeIS}, telnetTerminalType...), cmdIAC, cmdSE)},
+			{send: []byte{cmdIAC, cmdWill, optEcho, cmdIAC, cmdWill, optSupressGoAhead, cmdIAC, cmdDo, optLinemode}, expect: []byte{cmdIAC, cmdDo, optEcho, cmdIAC, cmdDo, optSupressGoAhead, cmdIAC, cmdWont, optLinemode}},
+			{send: []byte("login\xff\xff: "), expect: []byte("user\xff\xffname")},
+		})
+	}()
+
+	logger := &testLogger{t}
+	timeout := 5 * time.Second
+	c, openErr := openTelnet(logger, "test", "lab1", "localhost"+addr, timeout, dialDirect)
+	if openErr != nil {
+		t.Fatalf("openTelnet: %v", openErr)
+	}
+	defer c.Close()
+
+	c.SetDeadline(time.Now().Add(timeout))
+
+	// negotiation is answered while waiting for data
+	buf := make([]byte, 100)
+	var data []byte
+	for !bytes.HasSuffix(data, []byte(": ")) {
+		n, readErr := c.Read(buf)
+		if readErr == telnetNegOnly {
+			continue
+		}
+		if readErr != nil {
+			t.Fatalf("read: %v", readErr)
+		}
+		data = append(data, buf[:n]...)
+	}
+	if string(data) != "login\xff: " {
+		t.Errorf("data: expected=%q got=%q", "login\xff: ", data)
+	}
+
+	n, writeErr := c.Write([]byte("user\xffname"))
+	if writeErr != nil {
+		t.Errorf("write: %v", writeErr)
+	}
+	if n != 9 {
+		t.Errorf("write: expected=9 got=%d", n)
+	}
+
+	if err := <-serverErr; err != nil {
+		t.Errorf("server: %v", err)
+	}
+}
+
+type telnetStep struct {
+	send   []byte
+	expect []byte
+}
+
+// scriptTelnet: scripted telnet server checking client responses
+func scriptTelnet(conn net.Conn, steps []telnetStep) error {
+	for i, s := range steps {
+		if _, err := conn.Write(s.send); err != nil {
+			return fmt.Errorf("step %d: send: %v", i, err)
+		}
+		buf := make([]byte, len(s.expect))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return fmt.Errorf("step %d: recv: %v", i, err)
+		}
+		if !bytes.Equal(buf, s.expect) {
+			return fmt.Errorf("step %d: expected=%q got=%q", i, s.expect, buf)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package dev
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -28,11 +30,7 @@ type transpTCP struct {
 type transpTelnet struct {
 	net.Conn
 	logger hasPrintf
-}
-
-type telnetOptions struct {
-	supressGoAhead bool
-	linemode       bool
+	state  *telnetState
 }
 
 func (s *transpTelnet) Read(b []byte) (int, error) {
@@ -40,10 +38,19 @@ func (s *transpTelnet) Read(b []byte) (int, error) {
 	if err1 != nil {
 		return n1, err1
 	}
-	n2, err2 := telnetNegotiation(b, n1, s, s.logger, false)
+	n2, err2 := telnetNegotiation(s.state, b, n1, s.Conn, s.logger, false)
 	return n2, err2
 }
 
+func (s *transpTelnet) Write(b []byte) (int, error) {
+	esc := telnetEscape(b)
+	n, err := s.Conn.Write(esc)
+	if n < len(esc) {
+		return n - bytes.Count(esc[:n], []byte{cmdIAC, cmdIAC}), err // count unescaped bytes
+	}
+	return len(b), err
+}
+
 type transpPipe struct {
 	proc     *exec.Cmd
 	stdout   io.ReadCloser
@@ -151,6 +158,64 @@ func (s *transpSSH) Close() error {
 	return nil
 }
 
+type transpNetconf struct {
+	devLabel string
+	conn     net.Conn
+	client   *ssh.Client
+	session  *ssh.Session
+	codec    *netconfCodec
+	msgID    int
+	pending  []byte // reply not yet delivered to reader
+	hello    bool   // session established by hello exchange
+}
+
+// Read delivers rpc replies with framing removed.
+func (s *transpNetconf) Read(b []byte) (int, error) {
+	if len(s.pending) == 0 {
+		msg, err := s.codec.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if replyErr := netconfReplyError(msg); replyErr != nil {
+			return 0, replyErr
+		}
+		s.pending = append(netconfStripDeclaration(msg), '\n')
+	}
+	n := copy(b, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write sends b as a single rpc.
+func (s *transpNetconf) Write(b []byte) (int, error) {
+	s.msgID++
+	if err := s.codec.writeMessage(netconfRPC(s.msgID, b)); err != nil {
+		return 0, fmt.Errorf("netconf write(%s): %v", b, err)
+	}
+	return len(b), nil
+}
+
+func (s *transpNetconf) SetDeadline(t time.Time) error {
+	return s.conn.SetDeadline(t)
+}
+
+func (s *transpNetconf) SetWriteDeadline(t time.Time) error {
+	return s.conn.SetWriteDeadline(t)
+}
+
+func (s *transpNetconf) Close() error {
+	if s.hello {
+		s.msgID++
+		s.codec.writeMessage(netconfRPC(s.msgID, []byte("<close-session/>"))) // best effort
+	}
+	err1 := s.session.Close()
+	err2 := s.conn.Close()
+	if err1 != nil || err2 != nil {
+		return fmt.Errorf("close error: session=[%v] conn=[%v]", err1, err2)
+	}
+	return nil
+}
+
 func openTransportPipe(logger hasPrintf, modelName, devID, hostPort, transports, user, pass string, args []string, debug bool, timeout time.Duration) (transp, string, bool, error) {
 	s, err := openPipe(logger, modelName, devID, hostPort, transports, user, pass, args, debug, timeout)
 	return s, "pipe", true, err
@@ -209,7 +274,7 @@ func openPipe(logger hasPrintf, modelName, devID, hostPort, transports, user, pa
 	return s, nil
 }
 
-func openTransport(logger hasPrintf, modelName, devID, hostPort, transports, user, pass string) (transp, string, bool, error) {
+func openTransport(logger hasPrintf, modelName, devID, hostPort, transports, user, pass string, auth sshAuth, hostKeys *hostKeyChecker, dial dialFunc) (transp, string, bool, error) {
 	tList := strings.Split(transports, ",")
 	if len(tList) < 1 {
 		return nil, transports, false, fmt.Errorf("openTransport: missing transports: [%s]", transports)
@@ -223,26 +288,46 @@ func openTransport(logger hasPrintf, modelName, devID, hostPort, transports, use
 		switch t {
 		case "ssh":
 			hp := forceHostPort(hostPort, "22")
-			s, err := openSSH(logger, modelName, devID, hp, timeout, user, pass)
+			s, err := openSSH(logger, modelName, devID, hp, timeout, user, pass, auth, hostKeys, dial)
+			if err == nil {
+				return s, t, true, nil
+			}
+			logger.Printf("openTransport: %v", err)
+			if _, keyErr := err.(*hostKeyError); keyErr {
+				return nil, t, false, err // do not fallback to other transports
+			}
+			lastErr = err
+		case "netconf":
+			hp := forceHostPort(hostPort, "830")
+			s, err := openNetconf(logger, modelName, devID, hp, timeout, user, pass, auth, hostKeys, dial)
 			if err == nil {
 				return s, t, true, nil
 			}
 			logger.Printf("openTransport: %v", err)
+			if _, keyErr := err.(*hostKeyError); keyErr {
+				return nil, t, false, err // do not fallback to other transports
+			}
 			lastErr = err
 		case "telnet":
 			hp := forceHostPort(hostPort, "23")
-			s, err := openTelnet(logger, modelName, devID, hp, timeout)
+			s, err := openTelnet(logger, modelName, devID, hp, timeout, dial)
 			if err == nil {
 				return s, t, false, nil
 			}
 			logger.Printf("openTransport: %v", err)
+			if _, keyErr := err.(*hostKeyError); keyErr {
+				return nil, t, false, err // do not fallback to other transports
+			}
 			lastErr = err
 		default:
-			s, err := openTCP(logger, modelName, devID, hostPort, timeout)
+			s, err := openTCP(logger, modelName, devID, hostPort, timeout, dial)
 			if err == nil {
 				return s, t, false, nil
 			}
 			logger.Printf("openTransport: %v", err)
+			if _, keyErr := err.(*hostKeyError); keyErr {
+				return nil, t, false, err // do not fallback to other transports
+			}
 			lastErr = err
 		}
 	}
@@ -258,37 +343,64 @@ func forceHostPort(hostPort, defaultPort string) string {
 	return hostPort
 }
 
-func hostKeyCheck(hostname string, remote net.Addr, key ssh.PublicKey) error {
-	return nil // FIXME hostKeyCheck accept anything
-}
-
-func openSSH(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration, user, pass string) (transp, error) {
-
-	conn, dialErr := net.DialTimeout("tcp", hostPort, timeout)
-	if dialErr != nil {
-		return nil, fmt.Errorf("openSSH: Dial: %s %s %s - %v", modelName, devID, hostPort, dialErr)
-	}
-
+// sshClientConfig builds ssh client settings shared by devices and jump hosts,
+// then old devices negotiate the same algorithms either way.
+func sshClientConfig(user string, authMethods []ssh.AuthMethod, timeout time.Duration, hostKeys *hostKeyChecker) *ssh.ClientConfig {
 	conf := &ssh.Config{}
 	conf.SetDefaults()
 	conf.Ciphers = append(conf.Ciphers, "3des-cbc") // 3des-cbc is needed for IOS XR
 
-	config := &ssh.ClientConfig{
-		Config: *conf,
-		User:   user,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(pass),
-		},
+	return &ssh.ClientConfig{
+		Config:          *conf,
+		User:            user,
+		Auth:            authMethods,
 		Timeout:         timeout,
-		HostKeyCallback: hostKeyCheck,
+		HostKeyCallback: hostKeys.check,
 	}
+}
+
+// dialSSH opens an authenticated ssh connection.
+func dialSSH(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration, user, pass string, auth sshAuth, hostKeys *hostKeyChecker, dial dialFunc) (net.Conn, *ssh.Client, error) {
+
+	authMethods, agentConn, authErr := sshAuthMethods(logger, fmt.Sprintf("%s %s %s", modelName, devID, hostPort), pass, auth)
+	if authErr != nil {
+		return nil, nil, fmt.Errorf("dialSSH: %v", authErr)
+	}
+	if agentConn != nil {
+		defer agentConn.Close() // agent is only needed during handshake
+	}
+
+	conn, dialErr := dial(hostPort, timeout)
+	if dialErr != nil {
+		if _, keyErr := dialErr.(*hostKeyError); keyErr {
+			return nil, nil, dialErr // jump host key rejected
+		}
+		return nil, nil, fmt.Errorf("dialSSH: Dial: %s %s %s - %v", modelName, devID, hostPort, dialErr)
+	}
+
+	config := sshClientConfig(user, authMethods, timeout, hostKeys)
 
 	c, chans, reqs, connErr := ssh.NewClientConn(conn, hostPort, config)
 	if connErr != nil {
-		return nil, fmt.Errorf("openSSH: NewClientConn: %s %s %s - %v", modelName, devID, hostPort, connErr)
+		conn.Close()
+		if hostKeys.failed != nil {
+			return nil, nil, hostKeys.failed
+		}
+		return nil, nil, fmt.Errorf("dialSSH: NewClientConn: %s %s %s - %v", modelName, devID, hostPort, connErr)
 	}
 
-	cli := ssh.NewClient(c, chans, reqs)
+	return conn, ssh.NewClient(c, chans, reqs), nil
+}
+
+func openSSH(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration, user, pass string, auth sshAuth, hostKeys *hostKeyChecker, dial dialFunc) (transp, error) {
+
+	conn, cli, dialErr := dialSSH(logger, modelName, devID, hostPort, timeout, user, pass, auth, hostKeys, dial)
+	if dialErr != nil {
+		if _, keyErr := dialErr.(*hostKeyError); keyErr {
+			return nil, dialErr
+		}
+		return nil, fmt.Errorf("openSSH: %v", dialErr)
+	}
 
 	s := &transpSSH{conn: conn, client: cli, devLabel: fmt.Sprintf("%s %s %s", modelName, devID, hostPort) /*, logger: logger*/}
 
@@ -333,20 +445,82 @@ func openSSH(logger hasPrintf, modelName, devID, hostPort string, timeout time.D
 	return s, nil
 }
 
-func openTelnet(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration) (transp, error) {
+func openNetconf(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration, user, pass string, auth sshAuth, hostKeys *hostKeyChecker, dial dialFunc) (transp, error) {
+
+	conn, cli, dialErr := dialSSH(logger, modelName, devID, hostPort, timeout, user, pass, auth, hostKeys, dial)
+	if dialErr != nil {
+		if _, keyErr := dialErr.(*hostKeyError); keyErr {
+			return nil, dialErr
+		}
+		return nil, fmt.Errorf("openNetconf: %v", dialErr)
+	}
+
+	s := &transpNetconf{conn: conn, client: cli, devLabel: fmt.Sprintf("%s %s %s", modelName, devID, hostPort)}
+
+	ses, sessionErr := s.client.NewSession()
+	if sessionErr != nil {
+		conn.Close()
+		return nil, fmt.Errorf("openNetconf: NewSession: %s - %v", s.devLabel, sessionErr)
+	}
+
+	s.session = ses
+
+	pipeOut, outErr := ses.StdoutPipe()
+	if outErr != nil {
+		s.Close()
+		return nil, fmt.Errorf("openNetconf: StdoutPipe: %s - %v", s.devLabel, outErr)
+	}
+
+	writer, wrErr := ses.StdinPipe()
+	if wrErr != nil {
+		s.Close()
+		return nil, fmt.Errorf("openNetconf: StdinPipe: %s - %v", s.devLabel, wrErr)
+	}
+
+	s.codec = &netconfCodec{r: bufio.NewReader(pipeOut), w: writer}
+
+	if subErr := ses.RequestSubsystem("netconf"); subErr != nil {
+		s.Close()
+		return nil, fmt.Errorf("openNetconf: subsystem: %s - %v", s.devLabel, subErr)
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	hello, helloErr := s.codec.hello()
+	if helloErr != nil {
+		s.Close()
+		return nil, fmt.Errorf("openNetconf: %s - %v", s.devLabel, helloErr)
+	}
+
+	s.hello = true
+
+	conn.SetDeadline(time.Time{})
+
+	logger.Printf("openNetconf: %s - session-id=%s chunked=%v", s.devLabel, hello.SessionID, s.codec.chunked)
+
+	return s, nil
+}
+
+func openTelnet(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration, dial dialFunc) (transp, error) {
 
-	conn, err := net.DialTimeout("tcp", hostPort, timeout)
+	conn, err := dial(hostPort, timeout)
 	if err != nil {
+		if _, keyErr := err.(*hostKeyError); keyErr {
+			return nil, err // jump host key rejected
+		}
 		return nil, fmt.Errorf("openTelnet: %s %s %s - %v", modelName, devID, hostPort, err)
 	}
 
-	return &transpTelnet{conn, logger}, nil
+	return &transpTelnet{Conn: conn, logger: logger, state: newTelnetState()}, nil
 }
 
-func openTCP(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration) (transp, error) {
+func openTCP(logger hasPrintf, modelName, devID, hostPort string, timeout time.Duration, dial dialFunc) (transp, error) {
 
-	conn, err := net.DialTimeout("tcp", hostPort, timeout)
+	conn, err := dial(hostPort, timeout)
 	if err != nil {
+		if _, keyErr := err.(*hostKeyError); keyErr {
+			return nil, err // jump host key rejected
+		}
 		return nil, fmt.Errorf("openTCP: %s %s %s - %v", modelName, devID, hostPort, err)
 	}
 
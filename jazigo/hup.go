@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadModelsOnSignal reloads declarative models whenever SIGHUP is received.
+// Existing devices keep the attributes copied from their model at creation time.
+func reloadModelsOnSignal(jaz *app) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		jaz.logf("reloadModelsOnSignal: SIGHUP received, reloading models")
+		loadModels(jaz)
+	}
+}
@@ -0,0 +1,6 @@
+package main
+
+// reloadModelsOnSignal does nothing, since there is no SIGHUP on Windows.
+// Models are reloaded when settings are saved in the admin page.
+func reloadModelsOnSignal(jaz *app) {
+}
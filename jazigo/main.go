@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -55,6 +56,8 @@ type app struct {
 	requestChan chan dev.FetchRequest
 
 	filterTable *dev.FilterTable
+
+	modelsDir string // declarative models
 }
 
 type hasPrintf interface {
@@ -87,6 +90,14 @@ func defaultHomeDir() string {
 	return home
 }
 
+func defaultKnownHosts() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
 func defaultRegionName() string {
 	region := os.Getenv("AWS_REGION")
 	if region == "" {
@@ -120,6 +131,11 @@ func main() {
 	var logCheckInterval time.Duration
 	var webListen string
 	var s3region string
+	var repositoryGit bool
+	var sftpKey string
+	var sftpKnownHosts string
+	var encryptionKey string
+	var maskKey string
 	var version bool
 
 	defaultHome := defaultHomeDir()
@@ -127,13 +143,21 @@ func main() {
 	defaultRepo := filepath.Join(defaultHome, "repo")
 	defaultLogPrefix := filepath.Join(defaultHome, "log", "jazigo.log.")
 	defaultStaticDir := filepath.Join(defaultHome, "www")
+	defaultModelsDir := filepath.Join(defaultHome, "models")
+	defaultMaskKey := filepath.Join(defaultHome, "etc", "mask.key")
 
 	flag.StringVar(&jaz.configPathPrefix, "configPathPrefix", defaultConfigPrefix, "configuration path prefix")
 	flag.StringVar(&jaz.repositoryPath, "repositoryPath", defaultRepo, "repository path")
 	flag.StringVar(&jaz.logPathPrefix, "logPathPrefix", defaultLogPrefix, "log path prefix")
 	flag.StringVar(&staticDir, "wwwStaticPath", defaultStaticDir, "directory for static www content")
+	flag.StringVar(&jaz.modelsDir, "modelsDir", defaultModelsDir, "directory for declarative models (*.yml) - reloaded on SIGHUP and on settings save")
 	flag.StringVar(&webListen, "webListen", ":8080", "address:port for web UI")
 	flag.StringVar(&s3region, "s3region", defaultRegionName(), "AWS S3 region")
+	flag.BoolVar(&repositoryGit, "repositoryGit", false, "commit backups into git repository at repositoryPath")
+	flag.StringVar(&sftpKey, "sftpKey", "", "private key for sftp:// paths - password is taken from env var JAZIGO_SFTP_PASSWORD")
+	flag.StringVar(&sftpKnownHosts, "sftpKnownHosts", defaultKnownHosts(), "known_hosts file for sftp:// paths")
+	flag.StringVar(&maskKey, "maskKey", defaultMaskKey, "key file for hashing masked secrets - created if missing - keep it out of repositoryPath")
+	flag.StringVar(&encryptionKey, "encryptionKey", "", "key file for encrypting saved files - create with: openssl rand -hex 32 > keyfile")
 	flag.BoolVar(&runOnce, "runOnce", false, "exit after scanning all devices once")
 	flag.BoolVar(&deviceDelete, "deviceDelete", false, "delete devices specified in stdin")
 	flag.BoolVar(&devicePurge, "devicePurge", false, "purge devices specified in stdin")
@@ -153,13 +177,13 @@ func main() {
 
 	jaz.logPathPrefix = addTrailingDot(jaz.logPathPrefix)
 
-	if store.S3Path(jaz.logPathPrefix) {
-		jaz.logf("logging to Amazon S3 is not supported: %s", jaz.logPathPrefix)
+	if store.Remote(jaz.logPathPrefix) {
+		jaz.logf("logging to remote storage is not supported: %s", jaz.logPathPrefix)
 		return
 	}
 
-	if store.S3Path(staticDir) {
-		jaz.logf("static dir on Amazon S3 is not supported: %s", staticDir)
+	if store.Remote(staticDir) {
+		jaz.logf("static dir on remote storage is not supported: %s", staticDir)
 		return
 	}
 
@@ -183,7 +207,12 @@ func main() {
 	jaz.logf("%s %s starting", appName, appVersion)
 
 	jaz.filterTable = dev.NewFilterTable(jaz.logger)
+	if maskErr := dev.LoadMaskKey(jaz.logger, maskKey); maskErr != nil {
+		jaz.logf("main: %v - masked secrets will be fully redacted", maskErr)
+	}
 	dev.RegisterModels(jaz.logger, jaz.table)
+	loadModels(jaz)
+	go reloadModelsOnSignal(jaz)
 
 	jaz.configPathPrefix = addTrailingDot(jaz.configPathPrefix)
 
@@ -192,6 +221,37 @@ func main() {
 
 	store.Init(jaz.logger, s3region)
 
+	if store.SFTPPath(jaz.repositoryPath) || store.SFTPPath(jaz.configPathPrefix) {
+		cfg := store.SFTPConfig{KeyFile: sftpKey, Password: os.Getenv("JAZIGO_SFTP_PASSWORD"), KnownHostsFile: sftpKnownHosts}
+		if sftpErr := store.SFTPInit(jaz.logger, cfg); sftpErr != nil {
+			jaz.logf("main: %v", sftpErr)
+			return
+		}
+	}
+
+	if encryptionKey != "" {
+		if repositoryGit {
+			jaz.logf("encryption is not supported for git repository")
+			return
+		}
+		if keyErr := store.SetEncryptionKey(encryptionKey); keyErr != nil {
+			jaz.logf("main: %v", keyErr)
+			return
+		}
+		jaz.logf("encryption key: %s", encryptionKey)
+	}
+
+	if repositoryGit {
+		if store.Remote(jaz.repositoryPath) {
+			jaz.logf("git repository on remote storage is not supported: %s", jaz.repositoryPath)
+			return
+		}
+		if gitErr := store.GitInit(jaz.logger, jaz.repositoryPath); gitErr != nil {
+			jaz.logf("main: %v", gitErr)
+			return
+		}
+	}
+
 	// load config
 	loadConfig(jaz, maxMainConfigLoadSize)
 
@@ -227,7 +287,7 @@ func main() {
 	repoPath := jaz.repoPath
 	repoPathFull := fmt.Sprintf("/%s/%s", appName, repoPath)
 	jaz.logf("static dir: path=[%s] mapped to dir=[%s]", repoPathFull, jaz.repositoryPath)
-	server.AddStaticDir(repoPath, jaz.repositoryPath)
+	http.Handle(repoPathFull+"/", repoFileHandler(repoPathFull+"/", jaz.repositoryPath, jaz.options)) // gowut serves http.DefaultServeMux
 
 	buildPublicWins(jaz, server)
 
@@ -250,6 +310,13 @@ func main() {
 	}
 }
 
+func loadModels(jaz *app) {
+	jaz.logf("models dir: %s", jaz.modelsDir)
+	if err := dev.LoadModels(jaz.logger, jaz.table, jaz.modelsDir); err != nil {
+		jaz.logf("loadModels: %v", err)
+	}
+}
+
 func scanLoop(jaz *app) {
 	for {
 		jaz.logf("scanLoop: starting")
@@ -286,6 +353,14 @@ func loadConfig(jaz *app, maxSize int64) {
 
 	jaz.options.Set(&cfg.Options)
 
+	if filterErr := jaz.filterTable.SetUserFilters(jaz.logger, cfg.Options.Filters); filterErr != nil {
+		jaz.logf("loadConfig: %v", filterErr)
+	}
+
+	if compressErr := store.SetCompression(cfg.Options.Compression); compressErr != nil {
+		jaz.logf("loadConfig: %v", compressErr)
+	}
+
 	for _, c := range cfg.Devices {
 		d, newErr := dev.NewDeviceFromConf(jaz.table, jaz.logger, &c)
 		if newErr != nil {
@@ -414,7 +489,7 @@ func manageDeviceList(jaz *app, imp, del, purge, list bool) error {
 				continue
 			}
 
-			f := strings.Fields(text)
+			f, sshOptions := splitDeviceOptions(strings.Fields(text))
 
 			count := len(f)
 			if count < 6 {
@@ -435,7 +510,18 @@ func manageDeviceList(jaz *app, imp, del, purge, list bool) error {
 				value++
 			}
 
-			dev.CreateDevice(jaz.table, jaz.logger, f[0], id, f[2], f[3], f[4], f[5], enable, debug, nil)
+			if createErr := dev.CreateDevice(jaz.table, jaz.logger, f[0], id, f[2], f[3], f[4], f[5], enable, debug, nil); createErr != nil {
+				continue
+			}
+
+			if len(sshOptions) > 0 {
+				d, getErr := jaz.table.GetDevice(id)
+				if getErr != nil {
+					return fmt.Errorf("device [%s] not found: %v", id, getErr)
+				}
+				setDeviceOptions(&d.DevConfig, sshOptions)
+				jaz.table.UpdateDevice(d)
+			}
 		}
 
 		saveConfig(jaz, conf.Change{})
@@ -455,7 +541,7 @@ func manageDeviceList(jaz *app, imp, del, purge, list bool) error {
 			if d.Debug {
 				debug = "debug"
 			}
-			fmt.Printf("%s %s %s %s %s %s %s %s\n", d.DevConfig.Model, d.DevConfig.ID, d.HostPort, d.Transports, d.LoginUser, d.LoginPassword, enable, debug)
+			fmt.Printf("%s %s %s %s %s %s %s %s%s\n", d.DevConfig.Model, d.DevConfig.ID, d.HostPort, d.Transports, d.LoginUser, d.LoginPassword, enable, debug, deviceOptions(&d.DevConfig))
 		}
 	}
 
@@ -466,9 +552,83 @@ func manageDeviceList(jaz *app, imp, del, purge, list bool) error {
 	return nil
 }
 
+// Optional key=value fields for device import.
+const (
+	optSSHAuth       = "sshauth="
+	optSSHKey        = "sshkey="
+	optSSHPassphrase = "sshpassphrase="
+	optSSHAgent      = "sshagent="
+	optProxy         = "proxy="
+)
+
+// splitDeviceOptions separates optional key=value fields from positional fields in a device import line.
+func splitDeviceOptions(fields []string) ([]string, []string) {
+	const positional = 6 // model id hostport transports username password
+
+	var options []string
+	f := fields[:0]
+
+	for i, field := range fields {
+		if i >= positional && isDeviceOption(field) {
+			options = append(options, field)
+			continue
+		}
+		f = append(f, field)
+	}
+
+	return f, options
+}
+
+func isDeviceOption(field string) bool {
+	for _, prefix := range []string{optSSHAuth, optSSHKey, optSSHPassphrase, optSSHAgent, optProxy} {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func setDeviceOptions(c *conf.DevConfig, options []string) {
+	for _, o := range options {
+		switch {
+		case strings.HasPrefix(o, optSSHAuth):
+			c.SSHAuth = o[len(optSSHAuth):]
+		case strings.HasPrefix(o, optSSHKey):
+			c.SSHKeyPaths = append(c.SSHKeyPaths, o[len(optSSHKey):])
+		case strings.HasPrefix(o, optSSHPassphrase):
+			c.SSHKeyPassphrase = o[len(optSSHPassphrase):]
+		case strings.HasPrefix(o, optSSHAgent):
+			c.SSHAgentSocket = o[len(optSSHAgent):]
+		case strings.HasPrefix(o, optProxy):
+			c.Proxy = o[len(optProxy):]
+		}
+	}
+}
+
+// deviceOptions formats device settings as optional key=value fields for device list.
+func deviceOptions(c *conf.DevConfig) string {
+	var options string
+	if c.SSHAuth != "" {
+		options += " " + optSSHAuth + c.SSHAuth
+	}
+	for _, k := range c.SSHKeyPaths {
+		options += " " + optSSHKey + k
+	}
+	if c.SSHKeyPassphrase != "" {
+		options += " " + optSSHPassphrase + c.SSHKeyPassphrase
+	}
+	if c.SSHAgentSocket != "" {
+		options += " " + optSSHAgent + c.SSHAgentSocket
+	}
+	if c.Proxy != "" {
+		options += " " + optProxy + c.Proxy
+	}
+	return options
+}
+
 func exclusiveLock(jaz *app) error {
 	configLockPath := fmt.Sprintf("%slock", jaz.configPathPrefix)
-	if !store.S3Path(configLockPath) {
+	if !store.Remote(configLockPath) {
 		var newErr error
 		if jaz.configLock, newErr = lockfile.New(configLockPath); newErr != nil {
 			return fmt.Errorf("exclusiveLock: new failure: '%s': %v", configLockPath, newErr)
@@ -479,7 +639,7 @@ func exclusiveLock(jaz *app) error {
 	}
 
 	repositoryLockPath := filepath.Join(jaz.repositoryPath, "lock")
-	if !store.S3Path(repositoryLockPath) {
+	if !store.Remote(repositoryLockPath) {
 		var newErr error
 		if jaz.repositoryLock, newErr = lockfile.New(repositoryLockPath); newErr != nil {
 			jaz.configLock.Unlock()
@@ -492,7 +652,7 @@ func exclusiveLock(jaz *app) error {
 	}
 
 	logLockPath := fmt.Sprintf("%slock", jaz.logPathPrefix)
-	if !store.S3Path(logLockPath) {
+	if !store.Remote(logLockPath) {
 		var newErr error
 		if jaz.logLock, newErr = lockfile.New(logLockPath); newErr != nil {
 			jaz.configLock.Unlock()
@@ -511,21 +671,21 @@ func exclusiveLock(jaz *app) error {
 
 func exclusiveUnlock(jaz *app) {
 	configLockPath := fmt.Sprintf("%slock", jaz.configPathPrefix)
-	if !store.S3Path(configLockPath) {
+	if !store.Remote(configLockPath) {
 		if err := jaz.configLock.Unlock(); err != nil {
 			jaz.logger.Printf("exclusiveUnlock: '%s': %v", configLockPath, err)
 		}
 	}
 
 	repositoryLockPath := filepath.Join(jaz.repositoryPath, "lock")
-	if !store.S3Path(repositoryLockPath) {
+	if !store.Remote(repositoryLockPath) {
 		if err := jaz.repositoryLock.Unlock(); err != nil {
 			jaz.logger.Printf("exclusiveUnlock: '%s': %v", repositoryLockPath, err)
 		}
 	}
 
 	logLockPath := fmt.Sprintf("%slock", jaz.logPathPrefix)
-	if !store.S3Path(logLockPath) {
+	if !store.Remote(logLockPath) {
 		if err := jaz.logLock.Unlock(); err != nil {
 			jaz.logger.Printf("exclusiveUnlock: '%s': %v", logLockPath, err)
 		}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/udhos/jazigo/conf"
+)
+
+func TestDeviceOptions(t *testing.T) {
+	line := []string{"linux", "auto", "host1", "ssh", "user", "pass", "sshkey=/k1", "en", "sshauth=publickey,password", "sshkey=/k2", "debug", "proxy=socks5://gw:1080"}
+
+	f, options := splitDeviceOptions(line)
+	if len(f) != 8 {
+		t.Errorf("splitDeviceOptions: positional expected=8 got=%d: %v", len(f), f)
+	}
+	if f[6] != "en" || f[7] != "debug" {
+		t.Errorf("splitDeviceOptions: bad positional fields: %v", f)
+	}
+
+	var c conf.DevConfig
+	setDeviceOptions(&c, options)
+	if c.SSHAuth != "publickey,password" {
+		t.Errorf("setDeviceOptions: sshauth=[%s]", c.SSHAuth)
+	}
+	if len(c.SSHKeyPaths) != 2 || c.SSHKeyPaths[0] != "/k1" || c.SSHKeyPaths[1] != "/k2" {
+		t.Errorf("setDeviceOptions: sshkey=%v", c.SSHKeyPaths)
+	}
+
+	if c.Proxy != "socks5://gw:1080" {
+		t.Errorf("setDeviceOptions: proxy=[%s]", c.Proxy)
+	}
+
+	if o := deviceOptions(&c); o != " sshauth=publickey,password sshkey=/k1 sshkey=/k2 proxy=socks5://gw:1080" {
+		t.Errorf("deviceOptions: [%s]", o)
+	}
+}
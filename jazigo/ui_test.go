@@ -1,7 +1,16 @@
 package main
 
 import (
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/udhos/jazigo/conf"
+	"github.com/udhos/jazigo/store"
+	"github.com/udhos/jazigo/temp"
 )
 
 func TestSplitBufLines(t *testing.T) {
@@ -26,3 +35,43 @@ func split(t *testing.T, input string, wantLineCount int) {
 		t.Errorf("splitBufLines: input=%v expected=%d got=%d", input, wantLineCount, count)
 	}
 }
+
+func TestRepoFileHandler(t *testing.T) {
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	store.SetCompression(store.CompressGzip)
+	defer store.SetCompression(store.CompressNone)
+
+	content := "hostname lab1\n"
+	writeFunc := func(w store.HasWrite) error {
+		_, err := w.Write([]byte(content))
+		return err
+	}
+	path, saveErr := store.SaveNewConfig(filepath.Join(repo, "lab1."), 10, log.New(ioutil.Discard, "", 0), writeFunc, false, "")
+	if saveErr != nil {
+		t.Fatalf("SaveNewConfig: %v", saveErr)
+	}
+	if raw, _ := ioutil.ReadFile(path); string(raw) == content {
+		t.Fatalf("file not compressed: %s", path)
+	}
+
+	options := conf.NewOptions()
+	options.Set(&conf.AppConfig{MaxConfigLoadSize: 1000})
+	h := repoFileHandler("/jazigo/repo/", repo, options)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/jazigo/repo/"+filepath.Base(path), nil))
+	if w.Code != 200 || w.Body.String() != content {
+		t.Errorf("decoded file: code=%d body=%q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("decoded file: content-type=%s", ct)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/jazigo/repo/missing.9", nil))
+	if w.Code != 404 {
+		t.Errorf("missing file: code=%d", w.Code)
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -167,6 +170,16 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 	propPanel.Add(propMsg)
 	propPanel.Add(propText)
 
+	hostKeyPanel := gwu.NewPanel()
+	hostKeyButtonAccept := gwu.NewButton("Accept offered key")
+	hostKeyMsg := gwu.NewLabel("No error")
+	hostKeyKnown := gwu.NewLabel("")
+	hostKeyOffered := gwu.NewLabel("")
+	hostKeyPanel.Add(hostKeyButtonAccept)
+	hostKeyPanel.Add(hostKeyMsg)
+	hostKeyPanel.Add(hostKeyKnown)
+	hostKeyPanel.Add(hostKeyOffered)
+
 	showPanel := gwu.NewPanel()
 	logPanel := gwu.NewPanel()
 	diffPanel := gwu.NewPanel()
@@ -176,6 +189,7 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 	panel.Add(gwu.NewLabel("Properties"), propPanel)  // tab 2
 	panel.Add(gwu.NewLabel("Error Log"), logPanel)    // tab 3
 	panel.Add(gwu.NewLabel("Diff"), diffPanel)        // tab 4
+	panel.Add(gwu.NewLabel("Host Key"), hostKeyPanel) // tab 5
 
 	const tabShow = 1 // index
 	const tabDiff = 4 // index
@@ -342,7 +356,25 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 			return
 		}
 
-		filesMsg.SetText(fmt.Sprintf("%d files", len(matches)))
+		// artifacts saved apart from main files
+		groups := [][]string{matches}
+		if d, getErr := jaz.table.GetDevice(devID); getErr == nil {
+			for _, a := range d.Attr.Artifacts {
+				_, artifactMatches, artifactErr := store.ListConfigSorted(prefix+a.Name+".", true, jaz.logger)
+				if artifactErr != nil {
+					jaz.logger.Printf("fileList: artifact '%s': %v", a.Name, artifactErr)
+					continue
+				}
+				groups = append(groups, artifactMatches)
+			}
+		}
+
+		var total int
+		for _, g := range groups {
+			total += len(g)
+		}
+
+		filesMsg.SetText(fmt.Sprintf("%d files", total))
 
 		filesTab.Clear()
 
@@ -362,63 +394,67 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 
 		// Scan files:
 
-		for i, m := range matches {
-			path := filepath.Join(dirname, m)
-			timeStr := "unknown"
-
-			modTime, size, infoErr := store.FileInfo(path)
-			if infoErr == nil {
-				timeStr = timestampString(modTime)
-			} else {
-				timeStr += fmt.Sprintf("(could not get file info: %v)", infoErr)
-			}
-
-			var filePath string
-
-			if store.S3Path(path) {
-				filePath = store.S3URL(path)
-			} else {
-				filePath = fmt.Sprintf("%s/%s/%s", jaz.repoPath, devID, m)
-			}
-			devLink := gwu.NewLink(m, filePath)
-
-			buttonView := gwu.NewButton("Open")
-			show := dev.DeviceFullPath(jaz.repositoryPath, devID, m)
-			buttonView.AddEHandlerFunc(func(e gwu.Event) {
-				loadView(e, show)
-				panel.SetSelected(tabShow)
-			}, gwu.ETypeClick)
-
-			listDiffSrc := gwu.NewListBox(matches)
-			buttonDiff := gwu.NewButton("Diff")
-
-			var diffFrom int
-			if i < len(matches)-1 {
-				// default diff src is previous file
-				diffFrom = i + 1
-			} else {
-				// there is no previous file
-				diffFrom = i
+		for _, matches := range groups {
+			matches := matches // captured by diff button handler
+			for i, m := range matches {
+				path := filepath.Join(dirname, m)
+				timeStr := "unknown"
+
+				modTime, size, infoErr := store.FileInfo(path)
+				if infoErr == nil {
+					timeStr = timestampString(modTime)
+				} else {
+					timeStr += fmt.Sprintf("(could not get file info: %v)", infoErr)
+				}
+
+				var devLink gwu.Comp
+				switch {
+				case store.S3Path(path):
+					devLink = gwu.NewLink(m, store.S3URL(path))
+				case store.GitPath(path), store.Remote(path):
+					devLink = gwu.NewLabel(m) // git history or remote storage: no file to download
+				default:
+					devLink = gwu.NewLink(m, fmt.Sprintf("%s/%s/%s", jaz.repoPath, devID, m))
+				}
+
+				buttonView := gwu.NewButton("Open")
+				show := dev.DeviceFullPath(jaz.repositoryPath, devID, m)
+				buttonView.AddEHandlerFunc(func(e gwu.Event) {
+					loadView(e, show)
+					panel.SetSelected(tabShow)
+				}, gwu.ETypeClick)
+
+				listDiffSrc := gwu.NewListBox(matches)
+				buttonDiff := gwu.NewButton("Diff")
+
+				var diffFrom int
+				if i < len(matches)-1 {
+					// default diff src is previous file
+					diffFrom = i + 1
+				} else {
+					// there is no previous file
+					diffFrom = i
+				}
+				listDiffSrc.SetSelectedIndices([]int{diffFrom})
+
+				diffTo := dev.DeviceFullPath(jaz.repositoryPath, devID, m)
+				buttonDiff.AddEHandlerFunc(func(e gwu.Event) {
+					from := listDiffSrc.SelectedIdx()
+					f := matches[from]
+					diffFrom := dev.DeviceFullPath(jaz.repositoryPath, devID, f)
+					loadDiff(e, diffFrom, diffTo)
+					panel.SetSelected(tabDiff)
+				}, gwu.ETypeClick)
+
+				filesTab.Add(devLink, row, 0)
+				filesTab.Add(buttonView, row, 1)
+				filesTab.Add(gwu.NewLabel(strconv.FormatInt(size, 10)), row, 2)
+				filesTab.Add(gwu.NewLabel(timeStr), row, 3)
+				filesTab.Add(listDiffSrc, row, 4)
+				filesTab.Add(buttonDiff, row, 5)
+
+				row++
 			}
-			listDiffSrc.SetSelectedIndices([]int{diffFrom})
-
-			diffTo := dev.DeviceFullPath(jaz.repositoryPath, devID, m)
-			buttonDiff.AddEHandlerFunc(func(e gwu.Event) {
-				from := listDiffSrc.SelectedIdx()
-				f := matches[from]
-				diffFrom := dev.DeviceFullPath(jaz.repositoryPath, devID, f)
-				loadDiff(e, diffFrom, diffTo)
-				panel.SetSelected(tabDiff)
-			}, gwu.ETypeClick)
-
-			filesTab.Add(devLink, row, 0)
-			filesTab.Add(buttonView, row, 1)
-			filesTab.Add(gwu.NewLabel(strconv.FormatInt(size, 10)), row, 2)
-			filesTab.Add(gwu.NewLabel(timeStr), row, 3)
-			filesTab.Add(listDiffSrc, row, 4)
-			filesTab.Add(buttonDiff, row, 5)
-
-			row++
 		}
 
 		// Attach CSS formatting to cells
@@ -450,11 +486,42 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 		e.MarkDirty(propPanel)
 	}
 
+	loadHostKey := func(e gwu.Event) {
+		defer e.MarkDirty(hostKeyPanel)
+
+		d, getErr := jaz.table.GetDevice(devID)
+		if getErr != nil {
+			hostKeyMsg.SetText(fmt.Sprintf("Get device error: %v", getErr))
+			hostKeyButtonAccept.SetEnabled(false)
+			return
+		}
+
+		known, knownErr := dev.KnownHostKeys(jaz.repositoryPath, d.HostPort)
+		switch {
+		case knownErr != nil:
+			hostKeyKnown.SetText(fmt.Sprintf("Could not read known hosts: %v", knownErr))
+		case len(known) == 0:
+			hostKeyKnown.SetText("Known keys: none")
+		default:
+			hostKeyKnown.SetText("Known keys: " + strings.Join(known, ", "))
+		}
+
+		pending := d.HostKeyPending()
+		if pending == "" {
+			hostKeyOffered.SetText("Offered key: no rejected key")
+		} else {
+			hostKeyOffered.SetText("Offered key: " + pending + " (REJECTED)")
+		}
+
+		hostKeyButtonAccept.SetEnabled(userIsLogged(e.Session()) && pending != "")
+	}
+
 	refresh := func(e gwu.Event) {
 		propButtonSave.SetEnabled(userIsLogged(e.Session()))
-		fileList(e)  // build file list
-		resetProp(e) // build file properties
-		loadLog(e)   // load log
+		fileList(e)    // build file list
+		resetProp(e)   // build file properties
+		loadLog(e)     // load log
+		loadHostKey(e) // load host keys
 		e.MarkDirty(win)
 	}
 
@@ -478,6 +545,11 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 			return
 		}
 
+		if checkErr := dev.ValidateHostKeyCheck(c.Attr.HostKeyCheck); checkErr != nil {
+			propMsg.SetText(fmt.Sprintf("Device error: %v", checkErr))
+			return
+		}
+
 		d, getErr := jaz.table.GetDevice(devID)
 		if getErr != nil {
 			propMsg.SetText(fmt.Sprintf("Get device error: %v", getErr))
@@ -504,6 +576,24 @@ func buildDeviceWindow(jaz *app, e gwu.Event, devID string) string {
 
 	}, gwu.ETypeClick)
 
+	hostKeyButtonAccept.AddEHandlerFunc(func(e gwu.Event) {
+
+		if !userIsLogged(e.Session()) {
+			return // refuse to accept
+		}
+
+		if acceptErr := dev.AcceptHostKey(jaz.table, jaz.logger, jaz.repositoryPath, devID); acceptErr != nil {
+			hostKeyMsg.SetText(fmt.Sprintf("Accept error: %v", acceptErr))
+			e.MarkDirty(hostKeyPanel)
+			return
+		}
+
+		loadHostKey(e)
+
+		hostKeyMsg.SetText("Host key accepted.")
+
+	}, gwu.ETypeClick)
+
 	refreshButton.AddEHandlerFunc(refresh, gwu.ETypeClick)
 
 	win.AddEHandlerFunc(refresh, gwu.ETypeWinLoad)
@@ -848,6 +938,27 @@ func buildCreateDevPanel(jaz *app, s gwu.Session, refresh func(gwu.Event), creat
 	return createDevPanel
 }
 
+// repoFileHandler serves files under repository dir, decoded since they might be compressed or encrypted.
+// Directories are served as plain static dir.
+func repoFileHandler(prefix, dir string, options *conf.Options) http.Handler {
+	static := http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rel := path.Clean("/" + strings.TrimPrefix(r.URL.Path, prefix)) // no escape from dir
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if info, statErr := os.Stat(p); statErr != nil || info.IsDir() {
+			static.ServeHTTP(w, r)
+			return
+		}
+		buf, readErr := store.FileRead(p, options.Get().MaxConfigLoadSize)
+		if readErr != nil {
+			http.Error(w, fmt.Sprintf("could not read file: %v", readErr), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(buf))
+		w.Write(buf)
+	})
+}
+
 func timestampString(ts time.Time) string {
 	if ts.IsZero() {
 		return "never"
@@ -1153,15 +1264,121 @@ func buildAdminWin(jaz *app, s gwu.Session) {
 
 		refresh(e)
 
+		if filterErr := jaz.filterTable.SetUserFilters(jaz.logger, opt.Filters); filterErr != nil {
+			settingsMsg.SetText(fmt.Sprintf("Saved. Filter error: %v", filterErr))
+			return
+		}
+
+		if compressErr := store.SetCompression(opt.Compression); compressErr != nil {
+			settingsMsg.SetText(fmt.Sprintf("Saved. Compression error: %v", compressErr))
+			return
+		}
+
+		if modelsErr := dev.LoadModels(jaz.logger, jaz.table, jaz.modelsDir); modelsErr != nil {
+			settingsMsg.SetText(fmt.Sprintf("Saved. Models error: %v", modelsErr))
+			return
+		}
+
 		settingsMsg.SetText("Saved.")
 
 	}, gwu.ETypeClick)
 
 	win.Add(settingsPanel)
 
+	win.Add(buildFilterTesterPanel(jaz, settingsText))
+
 	win.AddEHandlerFunc(refresh, gwu.ETypeWinLoad)
 
 	s.AddWin(win)
 
 	jaz.winAdmin = win
 }
+
+// buildFilterTesterPanel previews the effect of line filters on the last saved backup of a device.
+// Filters are taken from the settings text box, so rules can be tested before saving.
+func buildFilterTesterPanel(jaz *app, settingsText gwu.TextBox) gwu.Panel {
+
+	panel := gwu.NewPanel()
+	panel.Add(gwu.NewLabel("Line Filter Tester"))
+
+	form := gwu.NewHorizontalPanel()
+	textID := gwu.NewTextBox("")
+	textFilter := gwu.NewTextBox("")
+	buttonPreview := gwu.NewButton("Preview")
+	form.Add(gwu.NewLabel("Device"))
+	form.Add(textID)
+	form.Add(gwu.NewLabel("Filters"))
+	form.Add(textFilter)
+	form.Add(buttonPreview)
+	panel.Add(form)
+
+	msg := gwu.NewLabel("Filters separated by spaces - empty means device filters")
+	file := gwu.NewLabel("")
+	output := gwu.NewTextBox("")
+	output.SetRows(20)
+	output.SetCols(100)
+	panel.Add(msg)
+	panel.Add(file)
+	panel.Add(output)
+
+	buttonPreview.AddEHandlerFunc(func(e gwu.Event) {
+
+		defer e.MarkDirty(panel)
+
+		output.SetText("")
+		file.SetText("")
+
+		devID := strings.TrimSpace(textID.Text())
+		d, getErr := jaz.table.GetDevice(devID)
+		if getErr != nil {
+			msg.SetText(fmt.Sprintf("Get device error: %v", getErr))
+			return
+		}
+
+		filterNames := strings.Fields(textFilter.Text())
+		if len(filterNames) < 1 {
+			filterNames = d.LineFilters()
+		}
+
+		opt, parseErr := conf.NewAppConfigFromString(settingsText.Text())
+		if parseErr != nil {
+			msg.SetText(fmt.Sprintf("Settings parsing error: %v", parseErr))
+			return
+		}
+
+		path, lastErr := store.FindLastConfig(dev.DeviceFullPrefix(jaz.repositoryPath, devID), jaz.logger)
+		if lastErr != nil {
+			msg.SetText(fmt.Sprintf("Could not find last backup: %v", lastErr))
+			return
+		}
+		file.SetText("File: " + path)
+
+		b, readErr := store.FileRead(path, jaz.options.Get().MaxConfigLoadSize)
+		if readErr != nil {
+			msg.SetText(fmt.Sprintf("Could not read '%s': %v", path, readErr))
+			return
+		}
+
+		result, filterErr := jaz.filterTable.Preview(jaz.logger, opt.Filters, filterNames, b)
+		if filterErr != nil {
+			msg.SetText(fmt.Sprintf("Filters %v error: %v", filterNames, filterErr))
+			return
+		}
+
+		nonEmpty := func(buf []byte) int {
+			var count int
+			for _, line := range splitBufLines(buf) {
+				if line != "" {
+					count++
+				}
+			}
+			return count
+		}
+
+		msg.SetText(fmt.Sprintf("Filters %v: non-empty lines: before=%d after=%d", filterNames, nonEmpty(b), nonEmpty(result)))
+		output.SetText(string(result))
+
+	}, gwu.ETypeClick)
+
+	return panel
+}
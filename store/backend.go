@@ -0,0 +1,175 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/udhos/equalfile"
+)
+
+// Backend stores files for paths under a scheme.
+type Backend interface {
+	FileExists(path string) bool
+	FileRemove(path string) error
+	FileRename(p1, p2 string) error
+	FileReader(path string) (io.ReadCloser, error)
+	FileWrite(path string, buf []byte, contentType string) error
+	FileInfo(path string) (time.Time, int64, error) // modification time and size
+	FileCompare(p1, p2 string) (bool, error)
+	DirList(path string) (string, []string, error) // directory of path and names in it
+	MkDir(path string) error
+}
+
+// committer is implemented by backends keeping their own history, like git.
+type committer interface {
+	SaveNewConfig(configPathPrefix string, logger hasPrintf, writeFunc func(HasWrite) error, info CommitInfo) (string, error)
+}
+
+type backendEntry struct {
+	scheme  string
+	backend Backend
+}
+
+// backends are selected by path scheme - paths without known scheme go to local filesystem.
+var backends = []backendEntry{
+	{"arn:aws:s3:", s3Backend{}}, // arn:aws:s3:region::bucket/folder/file
+	{"sftp:", sftpBackend{}},     // sftp://user@host[:port]/folder/file
+}
+
+// RegisterBackend selects backend for paths starting with scheme, like "mem:" for NewMemoryBackend in tests.
+// Registration is not safe for concurrent use with other store functions.
+func RegisterBackend(scheme string, b Backend) {
+	for i, e := range backends {
+		if e.scheme == scheme {
+			backends[i].backend = b
+			return
+		}
+	}
+	backends = append(backends, backendEntry{scheme: scheme, backend: b})
+}
+
+// Remote checks if path is stored away from local filesystem, like S3 or SFTP.
+func Remote(path string) bool {
+	switch backendFor(path).(type) {
+	case fsBackend, gitBackend:
+		return false
+	}
+	return true
+}
+
+func backendFor(path string) Backend {
+	for _, e := range backends {
+		if strings.HasPrefix(path, e.scheme) {
+			return e.backend
+		}
+	}
+	if gitpath(path) {
+		return gitBackend{}
+	}
+	return fsBackend{}
+}
+
+// fsBackend stores files in local filesystem.
+type fsBackend struct{}
+
+func (fsBackend) FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (fsBackend) FileRemove(path string) error {
+	return os.Remove(path)
+}
+
+func (fsBackend) FileRename(p1, p2 string) error {
+	return os.Rename(p1, p2)
+}
+
+func (fsBackend) FileReader(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (fsBackend) FileWrite(path string, buf []byte, contentType string) error {
+	return ioutil.WriteFile(path, buf, 0640)
+}
+
+func (fsBackend) FileInfo(path string) (time.Time, int64, error) {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return time.Time{}, 0, statErr
+	}
+	return info.ModTime(), info.Size(), nil
+}
+
+func (fsBackend) FileCompare(p1, p2 string) (bool, error) {
+	cmp := equalfile.New(nil, equalfile.Options{})
+	return cmp.CompareFile(p1, p2)
+}
+
+func (fsBackend) DirList(path string) (string, []string, error) {
+	dirname := filepath.Dir(path)
+
+	dir, err := os.Open(dirname)
+	if err != nil {
+		return dirname, nil, fmt.Errorf("ListConfig: error opening dir '%s': %v", dirname, err)
+	}
+
+	defer dir.Close()
+
+	names, err2 := dir.Readdirnames(0)
+	if err2 != nil {
+		return dirname, nil, fmt.Errorf("ListConfig: error reading dir '%s': %v", dirname, err2)
+	}
+
+	return dirname, names, nil
+}
+
+func (fsBackend) MkDir(path string) error {
+	return os.MkdirAll(path, 0750)
+}
+
+// s3Backend stores files in AWS S3.
+type s3Backend struct{}
+
+func (s3Backend) FileExists(path string) bool {
+	return s3fileExists(path)
+}
+
+func (s3Backend) FileRemove(path string) error {
+	return s3fileRemove(path)
+}
+
+func (s3Backend) FileRename(p1, p2 string) error {
+	return s3fileRename(p1, p2)
+}
+
+func (s3Backend) FileReader(path string) (io.ReadCloser, error) {
+	return s3fileReader(path)
+}
+
+func (s3Backend) FileWrite(path string, buf []byte, contentType string) error {
+	return s3fileput(path, buf, contentType)
+}
+
+func (s3Backend) FileInfo(path string) (time.Time, int64, error) {
+	return s3fileInfo(path)
+}
+
+func (s3Backend) FileCompare(p1, p2 string) (bool, error) {
+	maxSize := int64(10000000) // 10M FIXME??
+	return s3fileCompare(p1, p2, maxSize)
+}
+
+func (s3Backend) DirList(path string) (string, []string, error) {
+	return s3dirList(path)
+}
+
+func (s3Backend) MkDir(path string) error {
+	s3log("store.MkDir: silently refusing to create unneeded dir path on S3: [%s]", path)
+	return nil
+}
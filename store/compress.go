@@ -0,0 +1,129 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression methods for files saved by SaveNewConfig.
+// Reading detects compressed files by magic number, then files saved under any setting remain readable.
+const (
+	CompressNone = ""
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+var (
+	compressLock sync.RWMutex
+	compression  string
+)
+
+// SetCompression selects compression for new files saved by SaveNewConfig: "gzip", "zstd" or "" for none.
+func SetCompression(method string) error {
+	switch method {
+	case CompressNone, CompressGzip, CompressZstd:
+	default:
+		return fmt.Errorf("SetCompression: unknown compression: '%s'", method)
+	}
+	compressLock.Lock()
+	compression = method
+	compressLock.Unlock()
+	return nil
+}
+
+func getCompression() string {
+	compressLock.RLock()
+	defer compressLock.RUnlock()
+	return compression
+}
+
+// compressedWith detects compression from magic number.
+func compressedWith(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, zstdMagic):
+		return CompressZstd
+	case bytes.HasPrefix(head, gzipMagic):
+		return CompressGzip
+	}
+	return CompressNone
+}
+
+// compress encodes buf.
+// Files carry no format header, reading detects format by magic number.
+// Then uncompressed content starting with gzip, zstd or encryption magic is wrapped with gzip even with compression off,
+// otherwise reading would wrongly decode it. Text configs never start with gzip or zstd magic.
+func compress(method string, buf []byte) ([]byte, error) {
+	if method == CompressNone && (compressedWith(buf) != CompressNone || bytes.HasPrefix(buf, []byte(encMagic))) {
+		method = CompressGzip
+	}
+
+	switch method {
+	case CompressGzip:
+		var out bytes.Buffer
+		w := gzip.NewWriter(&out)
+		if _, err := w.Write(buf); err != nil {
+			return nil, fmt.Errorf("compress: gzip: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("compress: gzip: %v", err)
+		}
+		return out.Bytes(), nil
+	case CompressZstd:
+		w, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("compress: zstd: %v", err)
+		}
+		defer w.Close()
+		return w.EncodeAll(buf, nil), nil
+	}
+
+	return buf, nil
+}
+
+// decompressReader wraps r with decompression detected from magic number.
+// Closing the result also closes r.
+func decompressReader(r io.ReadCloser) (io.ReadCloser, string, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(zstdMagic)) // short files are reported by Peek as error
+
+	method := compressedWith(head)
+
+	switch method {
+	case CompressGzip:
+		z, err := gzip.NewReader(br)
+		if err != nil {
+			r.Close()
+			return nil, method, fmt.Errorf("decompress: gzip: %v", err)
+		}
+		return readCloser{Reader: z, close: func() error { z.Close(); return r.Close() }}, method, nil
+	case CompressZstd:
+		z, err := zstd.NewReader(br)
+		if err != nil {
+			r.Close()
+			return nil, method, fmt.Errorf("decompress: zstd: %v", err)
+		}
+		return readCloser{Reader: z, close: func() error { z.Close(); return r.Close() }}, method, nil
+	}
+
+	return readCloser{Reader: br, close: r.Close}, method, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
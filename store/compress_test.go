@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+
+	logger := &testLogger{t}
+
+	mem := NewMemoryBackend()
+	RegisterBackend("memcompress:", mem)
+	defer SetCompression(CompressNone)
+
+	save := func(prefix, content string, changesOnly bool) string {
+		writeFunc := func(w HasWrite) error {
+			_, err := w.Write([]byte(content))
+			return err
+		}
+		path, err := SaveNewConfig(prefix, 10, logger, writeFunc, changesOnly, "")
+		if err != nil {
+			t.Fatalf("SaveNewConfig: %v", err)
+		}
+		return path
+	}
+
+	raw := func(path string) []byte {
+		r, err := mem.FileReader(path)
+		if err != nil {
+			t.Fatalf("FileReader: %v", err)
+		}
+		defer r.Close()
+		buf, _ := ioutil.ReadAll(r)
+		return buf
+	}
+
+	content := "hostname lab1\ninterface eth0\n"
+
+	for _, method := range []string{CompressGzip, CompressZstd} {
+		if err := SetCompression(method); err != nil {
+			t.Fatalf("SetCompression: %v", err)
+		}
+
+		prefix := "memcompress:" + method + "/lab1."
+		path := save(prefix, content, false)
+
+		if got := compressedWith(raw(path)); got != method {
+			t.Errorf("%s: stored file compression: got=[%s]", method, got)
+		}
+
+		buf, readErr := FileRead(path, 1000)
+		if readErr != nil {
+			t.Fatalf("%s: FileRead: %v", method, readErr)
+		}
+		if string(buf) != content {
+			t.Errorf("%s: FileRead: got=[%s] wanted=[%s]", method, buf, content)
+		}
+
+		// maxSize applies to decompressed size
+		if _, err := FileRead(path, 10); err == nil {
+			t.Errorf("%s: FileRead: expected size error", method)
+		}
+
+		// changes only: same content under other compression is unchanged
+		SetCompression(CompressNone)
+		if again := save(prefix, content, true); again != path {
+			t.Errorf("%s: changesOnly: unchanged content saved as new file: %s", method, again)
+		}
+		if changed := save(prefix, content+"!", true); changed == path {
+			t.Errorf("%s: changesOnly: changed content not saved", method)
+		}
+	}
+
+	// uncompressed content looking like compressed or encrypted is stored gzip-wrapped,
+	// and must be read back unchanged
+	SetCompression(CompressNone)
+	for i, looks := range []string{string(gzipMagic) + "binary", string(zstdMagic) + "binary", encMagic + "text"} {
+		path := save("memcompress:none/lab"+strconv.Itoa(i)+".", looks, false)
+		if got := compressedWith(raw(path)); got != CompressGzip {
+			t.Errorf("%q: stored file compression: got=[%s] wanted=[%s]", looks, got, CompressGzip)
+		}
+		buf, readErr := FileRead(path, 1000)
+		if readErr != nil {
+			t.Fatalf("FileRead: %v", readErr)
+		}
+		if !bytes.Equal(buf, []byte(looks)) {
+			t.Errorf("FileRead: got=%v wanted=%v", buf, []byte(looks))
+		}
+	}
+
+	// other content is stored as is
+	if path := save("memcompress:none/plain.", content, false); !bytes.Equal(raw(path), []byte(content)) {
+		t.Errorf("plain content stored as: %q", raw(path))
+	}
+
+	if err := SetCompression("lz4"); err == nil {
+		t.Errorf("SetCompression: expected error for unknown method")
+	}
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Encryption at rest: files saved by SaveNewConfig are sealed with a random data key,
+// and the data key is sealed with the master key from the key file (envelope encryption):
+//
+//	magic | key id (8) | nonce (12) + sealed data key (32+16) | nonce (12) + sealed content
+//
+// Reading detects encrypted files by magic, then files saved before enabling encryption remain readable.
+
+const (
+	encMagic       = "jazigo-aesgcm-1\n"
+	encKeyIDSize   = 8
+	encKeySize     = 32 // AES-256
+	encNonceSize   = 12
+	encOverhead    = 16 // GCM tag
+	encWrappedSize = encNonceSize + encKeySize + encOverhead
+	encHeaderSize  = len(encMagic) + encKeyIDSize + encWrappedSize + encNonceSize
+)
+
+type encryptionKey struct {
+	id   []byte
+	aead cipher.AEAD
+}
+
+var (
+	encLock sync.RWMutex
+	encKey  *encryptionKey // nil means encryption disabled
+)
+
+// SetEncryptionKey enables encryption of new files saved by SaveNewConfig, using the master key from keyFile.
+// The key file holds 32 random bytes, either raw or hex-encoded: openssl rand -hex 32 > keyfile
+// Empty keyFile disables encryption.
+func SetEncryptionKey(keyFile string) error {
+	if keyFile == "" {
+		encLock.Lock()
+		encKey = nil
+		encLock.Unlock()
+		return nil
+	}
+
+	buf, readErr := ioutil.ReadFile(keyFile)
+	if readErr != nil {
+		return fmt.Errorf("SetEncryptionKey: %v", readErr)
+	}
+
+	key := buf
+	if len(key) != encKeySize {
+		var hexErr error
+		key, hexErr = hex.DecodeString(string(bytes.TrimSpace(buf)))
+		if hexErr != nil || len(key) != encKeySize {
+			return fmt.Errorf("SetEncryptionKey: key file '%s' must hold %d raw bytes or %d hex digits", keyFile, encKeySize, 2*encKeySize)
+		}
+	}
+
+	k, keyErr := newEncryptionKey(key)
+	if keyErr != nil {
+		return fmt.Errorf("SetEncryptionKey: %v", keyErr)
+	}
+
+	encLock.Lock()
+	encKey = k
+	encLock.Unlock()
+
+	return nil
+}
+
+func getEncryptionKey() *encryptionKey {
+	encLock.RLock()
+	defer encLock.RUnlock()
+	return encKey
+}
+
+func newEncryptionKey(key []byte) (*encryptionKey, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &encryptionKey{id: sum[:encKeyIDSize], aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return nil, fmt.Errorf("random: %v", err)
+	}
+	return buf, nil
+}
+
+// encrypt seals buf with a new data key.
+func encrypt(k *encryptionKey, buf []byte) ([]byte, error) {
+	dataKey, keyErr := randomBytes(encKeySize)
+	if keyErr != nil {
+		return nil, fmt.Errorf("encrypt: %v", keyErr)
+	}
+	wrapNonce, nonceErr := randomBytes(encNonceSize)
+	if nonceErr != nil {
+		return nil, fmt.Errorf("encrypt: %v", nonceErr)
+	}
+	dataNonce, nonceErr2 := randomBytes(encNonceSize)
+	if nonceErr2 != nil {
+		return nil, fmt.Errorf("encrypt: %v", nonceErr2)
+	}
+	data, aeadErr := newAEAD(dataKey)
+	if aeadErr != nil {
+		return nil, fmt.Errorf("encrypt: %v", aeadErr)
+	}
+
+	out := make([]byte, 0, encHeaderSize+len(buf)+encOverhead)
+	out = append(out, encMagic...)
+	out = append(out, k.id...)
+	header := out[:len(out):len(out)] // magic and key id are authenticated as additional data
+	out = append(out, wrapNonce...)
+	out = k.aead.Seal(out, wrapNonce, dataKey, header)
+	out = append(out, dataNonce...)
+	out = data.Seal(out, dataNonce, buf, header)
+
+	return out, nil
+}
+
+// decrypt opens buf sealed by encrypt.
+func decrypt(k *encryptionKey, buf []byte) ([]byte, error) {
+	if k == nil {
+		return nil, fmt.Errorf("decrypt: file is encrypted, but no encryption key is set")
+	}
+	if len(buf) < encHeaderSize+encOverhead {
+		return nil, fmt.Errorf("decrypt: truncated file: size=%d", len(buf))
+	}
+
+	header := buf[:len(encMagic)+encKeyIDSize]
+	if !bytes.Equal(header[len(encMagic):], k.id) {
+		return nil, fmt.Errorf("decrypt: file was encrypted with other key: id=%x", header[len(encMagic):])
+	}
+
+	wrapped := buf[len(header) : len(header)+encWrappedSize]
+	dataKey, unwrapErr := k.aead.Open(nil, wrapped[:encNonceSize], wrapped[encNonceSize:], header)
+	if unwrapErr != nil {
+		return nil, fmt.Errorf("decrypt: data key: %v", unwrapErr)
+	}
+
+	data, aeadErr := newAEAD(dataKey)
+	if aeadErr != nil {
+		return nil, fmt.Errorf("decrypt: %v", aeadErr)
+	}
+
+	sealed := buf[len(header)+encWrappedSize:]
+	plain, openErr := data.Open(nil, sealed[:encNonceSize], sealed[encNonceSize:], header)
+	if openErr != nil {
+		return nil, fmt.Errorf("decrypt: %v", openErr)
+	}
+
+	return plain, nil
+}
+
+// decryptReader wraps r with decryption, if encrypted.
+// Closing the result also closes r.
+func decryptReader(r io.ReadCloser) (io.ReadCloser, bool, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(encMagic)) // short files are reported by Peek as error
+
+	if string(head) != encMagic {
+		return readCloser{Reader: br, close: r.Close}, false, nil
+	}
+
+	buf, readErr := ioutil.ReadAll(br)
+	r.Close()
+	if readErr != nil {
+		return nil, true, readErr
+	}
+
+	plain, decryptErr := decrypt(getEncryptionKey(), buf)
+	if decryptErr != nil {
+		return nil, true, decryptErr
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(plain)), true, nil
+}
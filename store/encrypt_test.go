@@ -0,0 +1,134 @@
+package store
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestEncryption(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	mem := NewMemoryBackend()
+	RegisterBackend("memencrypt:", mem)
+	defer SetEncryptionKey("")
+	defer SetCompression(CompressNone)
+
+	keyFile := filepath.Join(repo, "key")
+	if err := ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(bytes.Repeat([]byte{1}, 32))+"\n"), 0600); err != nil {
+		t.Fatalf("key file: %v", err)
+	}
+	otherKeyFile := filepath.Join(repo, "other-key")
+	if err := ioutil.WriteFile(otherKeyFile, bytes.Repeat([]byte{2}, 32), 0600); err != nil {
+		t.Fatalf("key file: %v", err)
+	}
+	badKeyFile := filepath.Join(repo, "bad-key")
+	if err := ioutil.WriteFile(badKeyFile, []byte("short\n"), 0600); err != nil {
+		t.Fatalf("key file: %v", err)
+	}
+
+	if err := SetEncryptionKey(badKeyFile); err == nil {
+		t.Errorf("SetEncryptionKey: expected error for bad key file")
+	}
+	if err := SetEncryptionKey(keyFile); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+
+	save := func(prefix, content string, changesOnly bool) string {
+		writeFunc := func(w HasWrite) error {
+			_, err := w.Write([]byte(content))
+			return err
+		}
+		path, err := SaveNewConfig(prefix, 10, logger, writeFunc, changesOnly, "")
+		if err != nil {
+			t.Fatalf("SaveNewConfig: %v", err)
+		}
+		return path
+	}
+
+	raw := func(path string) []byte {
+		r, err := mem.FileReader(path)
+		if err != nil {
+			t.Fatalf("FileReader: %v", err)
+		}
+		defer r.Close()
+		buf, _ := ioutil.ReadAll(r)
+		return buf
+	}
+
+	content := "username lab password 0 secret123\n"
+
+	for _, method := range []string{CompressNone, CompressZstd} {
+		SetCompression(method)
+
+		prefix := "memencrypt:" + method + "/lab1."
+		path := save(prefix, content, false)
+
+		stored := raw(path)
+		if !strings.HasPrefix(string(stored), encMagic) || bytes.Contains(stored, []byte("secret123")) {
+			t.Errorf("compression=[%s]: stored file is not encrypted: %q", method, stored)
+		}
+
+		buf, readErr := FileRead(path, 1000)
+		if readErr != nil {
+			t.Fatalf("compression=[%s]: FileRead: %v", method, readErr)
+		}
+		if string(buf) != content {
+			t.Errorf("compression=[%s]: FileRead: got=[%s] wanted=[%s]", method, buf, content)
+		}
+
+		// changes only: every save uses a new data key, but contents are compared
+		if again := save(prefix, content, true); again != path {
+			t.Errorf("compression=[%s]: changesOnly: unchanged content saved as new file: %s", method, again)
+		}
+	}
+
+	SetCompression(CompressNone)
+
+	// files saved before enabling encryption remain readable
+	SetEncryptionKey("")
+	plainPath := save("memencrypt:plain/lab1.", content, false)
+	looksEncrypted := save("memencrypt:plain/lab2.", encMagic+"plain", false)
+	SetEncryptionKey(keyFile)
+	if buf, err := FileRead(plainPath, 1000); err != nil || string(buf) != content {
+		t.Errorf("FileRead plain file: content=[%s] error: %v", buf, err)
+	}
+	if buf, err := FileRead(looksEncrypted, 1000); err != nil || string(buf) != encMagic+"plain" {
+		t.Errorf("FileRead plain file looking encrypted: content=[%s] error: %v", buf, err)
+	}
+
+	// empty files, like new log files, are kept plain for appending
+	empty := save("memencrypt:empty/log.", "", false)
+	if stored := raw(empty); len(stored) != 0 {
+		t.Errorf("empty file stored as: %q", stored)
+	}
+
+	// other keys can not read
+	encrypted := "memencrypt:" + CompressNone + "/lab1.0"
+	SetEncryptionKey(otherKeyFile)
+	if _, err := FileRead(encrypted, 1000); err == nil {
+		t.Errorf("FileRead: expected error with other key")
+	}
+	SetEncryptionKey("")
+	if _, err := FileRead(encrypted, 1000); err == nil {
+		t.Errorf("FileRead: expected error without key")
+	}
+
+	// tampering is detected
+	SetEncryptionKey(keyFile)
+	stored := raw(encrypted)
+	stored[len(stored)-1] ^= 1
+	mem.FileWrite(encrypted, stored, "")
+	if _, err := FileRead(encrypted, 1000); err == nil {
+		t.Errorf("FileRead: expected error for tampered file")
+	}
+}
@@ -0,0 +1,537 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/udhos/equalfile"
+)
+
+// Git store: each backup is committed into a single file per device under a local git repository.
+// History is never pruned. Backups are exposed as virtual numbered files, then callers are unaware of git:
+//
+//	prefix "repo/lab1/lab1." => working file "repo/lab1/lab1"
+//	virtual file "repo/lab1/lab1.3" => 3rd commit touching "lab1/lab1"
+//
+// Numbered files saved before enabling the git store are moved into history by GitInit.
+
+var (
+	gitRoot string     // repository root - "" means git store disabled
+	gitLock sync.Mutex // serialize commits from concurrent fetches
+)
+
+// gitCommits caches commit lists, since every virtual file access needs one.
+// The cache is refreshed by listings and by commits from jazigo.
+var (
+	gitCacheLock sync.Mutex
+	gitCache     = map[string][]gitCommit{} // working file => commits
+)
+
+// CommitInfo is metadata for git commits.
+type CommitInfo struct {
+	AuthorName  string
+	AuthorEmail string
+	Message     string
+}
+
+// GitInit enables the git store for files under root directory.
+// The git repository is created if needed.
+func GitInit(logger hasPrintf, root string) error {
+	if _, lookErr := exec.LookPath("git"); lookErr != nil {
+		return fmt.Errorf("GitInit: %v", lookErr)
+	}
+
+	abs, absErr := filepath.Abs(root)
+	if absErr != nil {
+		return fmt.Errorf("GitInit: %v", absErr)
+	}
+
+	if mkdirErr := os.MkdirAll(abs, 0750); mkdirErr != nil {
+		return fmt.Errorf("GitInit: %v", mkdirErr)
+	}
+
+	if _, statErr := os.Stat(filepath.Join(abs, ".git")); statErr != nil {
+		if _, initErr := gitRun(abs, nil, "init", "-q"); initErr != nil {
+			return fmt.Errorf("GitInit: %v", initErr)
+		}
+		logger.Printf("git store: created repository: %s", abs)
+	}
+
+	gitRoot = abs
+	gitCacheReset()
+
+	if importErr := gitImport(logger); importErr != nil {
+		gitRoot = ""
+		return fmt.Errorf("GitInit: %v", importErr)
+	}
+
+	logger.Printf("git store: initialized: %s", abs)
+
+	return nil
+}
+
+// gitImport moves numbered files found under repository root into history of their working files.
+// Otherwise they would be hidden by virtual files.
+func gitImport(logger hasPrintf) error {
+
+	found := map[string][]int{} // working file => commit ids
+
+	walkErr := filepath.Walk(gitRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		lastDot := strings.LastIndexByte(path, '.')
+		if lastDot < 0 || !allDigits(path[lastDot+1:]) || strings.ContainsRune(path[lastDot:], filepath.Separator) {
+			return nil
+		}
+		id, convErr := strconv.Atoi(path[lastDot+1:])
+		if convErr != nil {
+			return nil
+		}
+		found[path[:lastDot]] = append(found[path[:lastDot]], id)
+		return nil
+	})
+	if walkErr != nil {
+		return fmt.Errorf("gitImport: %v", walkErr)
+	}
+
+	files := make([]string, 0, len(found))
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		commits, logErr := gitLog(file)
+		if logErr != nil {
+			return fmt.Errorf("gitImport: %v", logErr)
+		}
+		if len(commits) > 0 {
+			return fmt.Errorf("gitImport: numbered files found for file with git history: %s - move them out of repository", file)
+		}
+
+		ids := found[file]
+		sort.Ints(ids)
+
+		for _, id := range ids {
+			path := file + "." + strconv.Itoa(id)
+			if err := gitImportFile(file, path); err != nil {
+				return fmt.Errorf("gitImport: %v", err)
+			}
+		}
+
+		for _, id := range ids {
+			path := file + "." + strconv.Itoa(id)
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("gitImport: %v", err)
+			}
+		}
+
+		logger.Printf("git store: imported %d numbered files into history: %s", len(ids), file)
+	}
+
+	gitCacheReset()
+
+	return nil
+}
+
+// gitImportFile commits numbered file content into working file, keeping file time as commit time.
+func gitImportFile(file, path string) error {
+	info, statErr := os.Stat(path)
+	if statErr != nil {
+		return statErr
+	}
+
+	f, openErr := fsBackend{}.FileReader(path)
+	if openErr != nil {
+		return openErr
+	}
+	r, _, decodeErr := decodeReader(path, f)
+	if decodeErr != nil {
+		return decodeErr
+	}
+	defer r.Close()
+
+	buf, readErr := ioutil.ReadAll(r)
+	if readErr != nil {
+		return fmt.Errorf("%s: %v", path, readErr)
+	}
+
+	rel, relErr := gitRel(file)
+	if relErr != nil {
+		return relErr
+	}
+
+	_, commitErr := gitCommitFile(file, rel, buf, CommitInfo{Message: "import " + filepath.Base(path)}, info.ModTime())
+
+	return commitErr
+}
+
+// GitPath checks if path is under git store.
+func GitPath(path string) bool {
+	return gitpath(path)
+}
+
+func gitpath(path string) bool {
+	if gitRoot == "" {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(abs, gitRoot+string(filepath.Separator))
+}
+
+// gitVirtual checks if path is a virtual numbered file under git store.
+// Other files under git store, like known_hosts, are plain files.
+func gitVirtual(path string) bool {
+	if !gitpath(path) {
+		return false
+	}
+	lastDot := strings.LastIndexByte(path, '.')
+	return lastDot >= 0 && allDigits(path[lastDot+1:]) && !strings.ContainsRune(path[lastDot:], filepath.Separator)
+}
+
+func gitRun(dir string, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Env = append(append(os.Environ(), "LC_ALL=C"), env...) // untranslated messages in errors
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// gitRel gets path relative to repository root.
+func gitRel(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(gitRoot, abs)
+}
+
+type gitCommit struct {
+	hash string
+	when time.Time
+}
+
+// gitLog lists commits touching file, oldest first.
+func gitLog(file string) ([]gitCommit, error) {
+	rel, relErr := gitRel(file)
+	if relErr != nil {
+		return nil, relErr
+	}
+
+	if _, headErr := gitRun(gitRoot, nil, "rev-parse", "--verify", "-q", "HEAD"); headErr != nil {
+		return nil, nil // empty repository
+	}
+
+	out, logErr := gitRun(gitRoot, nil, "log", "--format=%H %ct", "--", rel)
+	if logErr != nil {
+		return nil, logErr
+	}
+
+	var commits []gitCommit
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			continue
+		}
+		sec, convErr := strconv.ParseInt(f[1], 10, 64)
+		if convErr != nil {
+			return nil, fmt.Errorf("gitLog: bad commit time: [%s]: %v", line, convErr)
+		}
+		commits = append([]gitCommit{{hash: f[0], when: time.Unix(sec, 0)}}, commits...)
+	}
+
+	return commits, nil
+}
+
+func gitCacheReset() {
+	gitCacheLock.Lock()
+	gitCache = map[string][]gitCommit{}
+	gitCacheLock.Unlock()
+}
+
+// gitLogRefresh runs gitLog and caches the result.
+func gitLogRefresh(file string) ([]gitCommit, error) {
+	commits, logErr := gitLog(file)
+	if logErr != nil {
+		return nil, logErr
+	}
+	gitCacheLock.Lock()
+	gitCache[file] = commits
+	gitCacheLock.Unlock()
+	return commits, nil
+}
+
+// gitLogCached gets commits from cache, running gitLog on cache miss.
+func gitLogCached(file string) ([]gitCommit, error) {
+	gitCacheLock.Lock()
+	commits, found := gitCache[file]
+	gitCacheLock.Unlock()
+	if found {
+		return commits, nil
+	}
+	return gitLogRefresh(file)
+}
+
+// gitFile gets working file for path prefix: "repo/lab1/lab1." => "repo/lab1/lab1"
+func gitFile(configPathPrefix string) string {
+	return strings.TrimSuffix(configPathPrefix, ".")
+}
+
+// gitResolve finds commit for virtual file: "repo/lab1/lab1.3" => "lab1/lab1", 3rd commit
+func gitResolve(path string) (string, gitCommit, error) {
+	lastDot := strings.LastIndexByte(path, '.')
+	if lastDot < 0 {
+		return "", gitCommit{}, fmt.Errorf("gitResolve: missing commit id: [%s]", path)
+	}
+	id, idErr := strconv.Atoi(path[lastDot+1:])
+	if idErr != nil {
+		return "", gitCommit{}, fmt.Errorf("gitResolve: bad commit id: [%s]: %v", path, idErr)
+	}
+
+	file := path[:lastDot]
+
+	commits, logErr := gitLogCached(file)
+	if logErr != nil {
+		return "", gitCommit{}, logErr
+	}
+	if id < 1 || id > len(commits) {
+		return "", gitCommit{}, fmt.Errorf("gitResolve: commit not found: [%s]", path)
+	}
+
+	rel, relErr := gitRel(file)
+	if relErr != nil {
+		return "", gitCommit{}, relErr
+	}
+
+	return filepath.ToSlash(rel), commits[id-1], nil
+}
+
+func gitDirList(configPathPrefix string) (string, []string, error) {
+	file := gitFile(configPathPrefix)
+	commits, logErr := gitLogRefresh(file)
+	if logErr != nil {
+		return filepath.Dir(file), nil, logErr
+	}
+	names := make([]string, len(commits))
+	base := filepath.Base(configPathPrefix)
+	for i := range commits {
+		names[i] = base + strconv.Itoa(i+1)
+	}
+	return filepath.Dir(file), names, nil
+}
+
+func gitFileExists(path string) bool {
+	_, _, err := gitResolve(path)
+	return err == nil
+}
+
+func gitFileReader(path string) (io.ReadCloser, error) {
+	rel, c, resolveErr := gitResolve(path)
+	if resolveErr != nil {
+		return nil, resolveErr
+	}
+	buf, showErr := gitRun(gitRoot, nil, "show", c.hash+":"+rel)
+	if showErr != nil {
+		return nil, showErr
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func gitFileInfo(path string) (time.Time, int64, error) {
+	rel, c, resolveErr := gitResolve(path)
+	if resolveErr != nil {
+		return time.Time{}, 0, resolveErr
+	}
+	out, sizeErr := gitRun(gitRoot, nil, "cat-file", "-s", c.hash+":"+rel)
+	if sizeErr != nil {
+		return time.Time{}, 0, sizeErr
+	}
+	size, convErr := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	if convErr != nil {
+		return time.Time{}, 0, convErr
+	}
+	return c.when, size, nil
+}
+
+// gitSaveNewConfig commits new content into working file.
+// Identical content creates no commit, since git history only records changes.
+func gitSaveNewConfig(configPathPrefix string, logger hasPrintf, writeFunc func(HasWrite) error, info CommitInfo) (string, error) {
+
+	w := &bytes.Buffer{}
+	if err := writeFunc(w); err != nil {
+		return "", fmt.Errorf("SaveNewConfig: writeFunc error: [%s]: %v", configPathPrefix, err)
+	}
+
+	file := gitFile(configPathPrefix)
+
+	rel, relErr := gitRel(file)
+	if relErr != nil {
+		return "", fmt.Errorf("SaveNewConfig: %v", relErr)
+	}
+
+	gitLock.Lock()
+	defer gitLock.Unlock()
+
+	changed, commitErr := gitCommitFile(file, rel, w.Bytes(), info, time.Time{})
+	if commitErr != nil {
+		return "", fmt.Errorf("SaveNewConfig: %v", commitErr)
+	}
+	if !changed {
+		logger.Printf("SaveNewConfig: git: no changes: [%s]", rel)
+	}
+
+	commits, logErr := gitLogRefresh(file)
+	if logErr != nil {
+		return "", fmt.Errorf("SaveNewConfig: %v", logErr)
+	}
+
+	newFilepath := configPathPrefix + strconv.Itoa(len(commits))
+
+	logger.Printf("SaveNewConfig: git: newPath=[%s]", newFilepath)
+
+	return newFilepath, nil
+}
+
+// gitCommitFile writes content into working file and commits it, if changed.
+// Zero when means current time.
+func gitCommitFile(file, rel string, content []byte, info CommitInfo, when time.Time) (bool, error) {
+	if err := ioutil.WriteFile(file, content, 0640); err != nil {
+		return false, err
+	}
+
+	if _, addErr := gitRun(gitRoot, nil, "add", "--", rel); addErr != nil {
+		return false, addErr
+	}
+
+	status, statusErr := gitRun(gitRoot, nil, "status", "--porcelain", "--", rel)
+	if statusErr != nil {
+		return false, statusErr
+	}
+
+	if len(bytes.TrimSpace(status)) == 0 {
+		return false, nil
+	}
+
+	if info.AuthorName == "" {
+		info.AuthorName = "jazigo"
+	}
+	if info.AuthorEmail == "" {
+		info.AuthorEmail = "jazigo@localhost"
+	}
+	if info.Message == "" {
+		info.Message = rel
+	}
+	env := []string{
+		"GIT_AUTHOR_NAME=" + info.AuthorName,
+		"GIT_AUTHOR_EMAIL=" + info.AuthorEmail,
+		"GIT_COMMITTER_NAME=jazigo",
+		"GIT_COMMITTER_EMAIL=jazigo@localhost",
+	}
+	if !when.IsZero() {
+		date := fmt.Sprintf("%d +0000", when.Unix())
+		env = append(env, "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	}
+	if _, commitErr := gitRun(gitRoot, env, "commit", "-q", "-m", info.Message, "--", rel); commitErr != nil {
+		return false, commitErr
+	}
+
+	return true, nil
+}
+
+// gitBackend exposes git history as virtual numbered files.
+// Other paths are handled as plain local files.
+type gitBackend struct {
+	fsBackend
+}
+
+func (b gitBackend) FileExists(path string) bool {
+	if gitVirtual(path) {
+		return gitFileExists(path)
+	}
+	return b.fsBackend.FileExists(path)
+}
+
+func (b gitBackend) FileReader(path string) (io.ReadCloser, error) {
+	if gitVirtual(path) {
+		return gitFileReader(path)
+	}
+	return b.fsBackend.FileReader(path)
+}
+
+func (b gitBackend) FileInfo(path string) (time.Time, int64, error) {
+	if gitVirtual(path) {
+		return gitFileInfo(path)
+	}
+	return b.fsBackend.FileInfo(path)
+}
+
+// FileRemove keeps virtual files, since history is never pruned.
+func (b gitBackend) FileRemove(path string) error {
+	if gitVirtual(path) {
+		return nil
+	}
+	return b.fsBackend.FileRemove(path)
+}
+
+// FileRename refuses virtual files, which are commits.
+func (b gitBackend) FileRename(p1, p2 string) error {
+	if gitVirtual(p1) || gitVirtual(p2) {
+		return fmt.Errorf("FileRename: can not rename git history: [%s] => [%s]", p1, p2)
+	}
+	return b.fsBackend.FileRename(p1, p2)
+}
+
+// FileCompare reads virtual files from their commits.
+func (b gitBackend) FileCompare(p1, p2 string) (bool, error) {
+	if !gitVirtual(p1) && !gitVirtual(p2) {
+		return b.fsBackend.FileCompare(p1, p2)
+	}
+
+	r1, err1 := b.FileReader(p1)
+	if err1 != nil {
+		return false, err1
+	}
+	defer r1.Close()
+
+	r2, err2 := b.FileReader(p2)
+	if err2 != nil {
+		return false, err2
+	}
+	defer r2.Close()
+
+	buf := make([]byte, 100000)
+	cmp := equalfile.New(buf, equalfile.Options{MaxSize: 10000000})
+	return cmp.CompareReader(r1, r2)
+}
+
+func (b gitBackend) DirList(path string) (string, []string, error) {
+	return gitDirList(path)
+}
+
+func (b gitBackend) SaveNewConfig(configPathPrefix string, logger hasPrintf, writeFunc func(HasWrite) error, info CommitInfo) (string, error) {
+	return gitSaveNewConfig(configPathPrefix, logger, writeFunc, info)
+}
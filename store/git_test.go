@@ -0,0 +1,216 @@
+package store
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/udhos/jazigo/temp"
+)
+
+func TestGitStore(t *testing.T) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("TestGitStore: git not found: %v", err)
+	}
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	root := filepath.Join(repo, "git")
+	if err := GitInit(logger, root); err != nil {
+		t.Fatalf("GitInit: %v", err)
+	}
+	defer func() { gitRoot = "" }()
+
+	if err := MkDir(filepath.Join(root, "lab1")); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	prefix := filepath.Join(root, "lab1", "lab1.")
+
+	save := func(content string) string {
+		writeFunc := func(w HasWrite) error {
+			_, err := w.Write([]byte(content))
+			return err
+		}
+		path, err := SaveNewConfigInfo(prefix, 1, logger, writeFunc, false, "", CommitInfo{AuthorName: "lab1", AuthorEmail: "cisco-ios@jazigo", Message: "lab1: fetch"})
+		if err != nil {
+			t.Fatalf("SaveNewConfigInfo: %v", err)
+		}
+		return path
+	}
+
+	if p := save("a"); p != prefix+"1" {
+		t.Errorf("save 1: %s", p)
+	}
+	if p := save("b"); p != prefix+"2" {
+		t.Errorf("save 2: %s", p)
+	}
+	if p := save("b"); p != prefix+"2" {
+		t.Errorf("save unchanged: %s", p)
+	}
+	if p := save("c"); p != prefix+"3" {
+		t.Errorf("save 3: %s", p)
+	}
+
+	// full history despite maxFiles=1
+	_, matches, listErr := ListConfigSorted(prefix, true, logger)
+	if listErr != nil {
+		t.Fatalf("ListConfigSorted: %v", listErr)
+	}
+	if strings.Join(matches, " ") != "lab1.3 lab1.2 lab1.1" {
+		t.Errorf("ListConfigSorted: %v", matches)
+	}
+
+	last, lastErr := FindLastConfig(prefix, logger)
+	if lastErr != nil || last != prefix+"3" {
+		t.Errorf("FindLastConfig: %s: %v", last, lastErr)
+	}
+
+	for i, expected := range []string{"a", "b", "c"} {
+		path := filepath.Join(root, "lab1", matches[2-i])
+		buf, readErr := FileRead(path, 100)
+		if readErr != nil || string(buf) != expected {
+			t.Errorf("FileRead: %s: [%s]: %v", path, buf, readErr)
+		}
+		if _, size, infoErr := FileInfo(path); infoErr != nil || size != 1 {
+			t.Errorf("FileInfo: %s: size=%d: %v", path, size, infoErr)
+		}
+		if !FileExists(path) {
+			t.Errorf("FileExists: %s", path)
+		}
+	}
+
+	if FileExists(prefix + "4") {
+		t.Errorf("FileExists: unexpected %s", prefix+"4")
+	}
+
+	author, logErr := gitRun(root, nil, "log", "-1", "--format=%an <%ae> %s")
+	if logErr != nil || strings.TrimSpace(string(author)) != "lab1 <cisco-ios@jazigo> lab1: fetch" {
+		t.Errorf("commit author: [%s]: %v", author, logErr)
+	}
+
+	// plain files under git store
+	known := filepath.Join(root, "known_hosts")
+	if err := FileWrite(known, []byte("x")); err != nil {
+		t.Fatalf("FileWrite: %v", err)
+	}
+	if buf, err := FileRead(known, 100); err != nil || string(buf) != "x" {
+		t.Errorf("FileRead plain file: [%s]: %v", buf, err)
+	}
+
+	// compare reads commits
+	plainC := filepath.Join(root, "plain-c")
+	if err := FileWrite(plainC, []byte("c")); err != nil {
+		t.Fatalf("FileWrite: %v", err)
+	}
+	compare := []struct {
+		p1, p2   string
+		expected bool
+	}{
+		{prefix + "2", prefix + "3", false},
+		{prefix + "3", prefix + "3", true},
+		{prefix + "3", plainC, true},
+		{known, prefix + "3", false},
+		{known, known, true},
+	}
+	for _, c := range compare {
+		if equal, err := fileCompare(c.p1, c.p2); err != nil || equal != c.expected {
+			t.Errorf("fileCompare: %s %s: equal=%v wanted=%v: %v", c.p1, c.p2, equal, c.expected, err)
+		}
+	}
+
+	// history is kept on remove
+	if err := fileRemove(prefix + "1"); err != nil {
+		t.Errorf("fileRemove: %v", err)
+	}
+	if !FileExists(prefix + "1") {
+		t.Errorf("fileRemove: removed history: %s", prefix+"1")
+	}
+	if err := fileRemove(plainC); err != nil || FileExists(plainC) {
+		t.Errorf("fileRemove plain file: %v", err)
+	}
+
+	// history can not be renamed
+	if err := fileRename(prefix+"1", prefix+"9"); err == nil {
+		t.Errorf("fileRename: expected error for virtual file")
+	}
+	if err := fileRename(known, prefix+"9"); err == nil {
+		t.Errorf("fileRename: expected error for virtual target")
+	}
+	if err := fileRename(known, known+".bak"); err != nil || !FileExists(known+".bak") {
+		t.Errorf("fileRename plain file: %v", err)
+	}
+}
+
+func TestGitImport(t *testing.T) {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("TestGitImport: git not found: %v", err)
+	}
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	// numbered files saved before enabling git store
+	root := filepath.Join(repo, "git")
+	if err := MkDir(filepath.Join(root, "lab1")); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+	prefix := filepath.Join(root, "lab1", "lab1.")
+	for i, content := range []string{"a", "b"} {
+		if err := FileWrite(prefix+strconv.Itoa(i+1), []byte(content)); err != nil {
+			t.Fatalf("FileWrite: %v", err)
+		}
+	}
+
+	if err := GitInit(logger, root); err != nil {
+		t.Fatalf("GitInit: %v", err)
+	}
+	defer func() { gitRoot = "" }()
+
+	if _, err := os.Stat(prefix + "1"); err == nil {
+		t.Errorf("numbered file not moved into history: %s", prefix+"1")
+	}
+
+	_, matches, listErr := ListConfigSorted(prefix, true, logger)
+	if listErr != nil {
+		t.Fatalf("ListConfigSorted: %v", listErr)
+	}
+	if strings.Join(matches, " ") != "lab1.2 lab1.1" {
+		t.Errorf("ListConfigSorted: %v", matches)
+	}
+	for i, expected := range []string{"a", "b"} {
+		path := prefix + strconv.Itoa(i+1)
+		if buf, err := FileRead(path, 100); err != nil || string(buf) != expected {
+			t.Errorf("FileRead: %s: [%s]: %v", path, buf, err)
+		}
+	}
+
+	writeFunc := func(w HasWrite) error {
+		_, err := w.Write([]byte("c"))
+		return err
+	}
+	if p, err := SaveNewConfigInfo(prefix, 1, logger, writeFunc, false, "", CommitInfo{}); err != nil || p != prefix+"3" {
+		t.Errorf("SaveNewConfigInfo: %s: %v", p, err)
+	}
+	if buf, err := FileRead(prefix+"3", 100); err != nil || string(buf) != "c" {
+		t.Errorf("FileRead: %s: [%s]: %v", prefix+"3", buf, err)
+	}
+
+	// numbered files can not be merged into existing history
+	gitRoot = ""
+	if err := FileWrite(prefix+"9", []byte("x")); err != nil {
+		t.Fatalf("FileWrite: %v", err)
+	}
+	if err := GitInit(logger, root); err == nil {
+		t.Errorf("GitInit: expected error for numbered file with git history")
+	}
+}
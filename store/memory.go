@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// memoryBackend keeps files in memory. Useful for tests.
+type memoryBackend struct {
+	lock  sync.RWMutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryBackend creates an empty in-memory backend.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{files: map[string]memoryFile{}}
+}
+
+func (m *memoryBackend) get(path string) (memoryFile, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	f, found := m.files[filepath.Clean(path)]
+	if !found {
+		return f, fmt.Errorf("memory store: file not found: [%s]", path)
+	}
+	return f, nil
+}
+
+func (m *memoryBackend) FileExists(path string) bool {
+	_, err := m.get(path)
+	return err == nil
+}
+
+func (m *memoryBackend) FileRemove(path string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	path = filepath.Clean(path)
+	if _, found := m.files[path]; !found {
+		return fmt.Errorf("memory store: remove: file not found: [%s]", path)
+	}
+	delete(m.files, path)
+	return nil
+}
+
+func (m *memoryBackend) FileRename(p1, p2 string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p1 = filepath.Clean(p1)
+	f, found := m.files[p1]
+	if !found {
+		return fmt.Errorf("memory store: rename: file not found: [%s]", p1)
+	}
+	delete(m.files, p1)
+	m.files[filepath.Clean(p2)] = f
+	return nil
+}
+
+func (m *memoryBackend) FileReader(path string) (io.ReadCloser, error) {
+	f, err := m.get(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func (m *memoryBackend) FileWrite(path string, buf []byte, contentType string) error {
+	data := make([]byte, len(buf))
+	copy(data, buf)
+	m.lock.Lock()
+	m.files[filepath.Clean(path)] = memoryFile{data: data, modTime: time.Now()}
+	m.lock.Unlock()
+	return nil
+}
+
+func (m *memoryBackend) FileInfo(path string) (time.Time, int64, error) {
+	f, err := m.get(path)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return f.modTime, int64(len(f.data)), nil
+}
+
+func (m *memoryBackend) FileCompare(p1, p2 string) (bool, error) {
+	f1, err1 := m.get(p1)
+	if err1 != nil {
+		return false, err1
+	}
+	f2, err2 := m.get(p2)
+	if err2 != nil {
+		return false, err2
+	}
+	return bytes.Equal(f1.data, f2.data), nil
+}
+
+func (m *memoryBackend) DirList(path string) (string, []string, error) {
+	dirname := filepath.Dir(path)
+	var names []string
+	m.lock.RLock()
+	for p := range m.files {
+		if filepath.Dir(p) == dirname {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	m.lock.RUnlock()
+	return dirname, names, nil
+}
+
+func (m *memoryBackend) MkDir(path string) error {
+	return nil // directories are implicit
+}
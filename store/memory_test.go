@@ -0,0 +1,42 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+
+	logger := &testLogger{t}
+
+	RegisterBackend("memtest:", NewMemoryBackend())
+
+	maxFiles := 2
+	prefix := "memtest:lab/store-test."
+	storeBatch(t, prefix, maxFiles, logger)
+
+	_, matches, listErr := ListConfigSorted(prefix, false, logger)
+	if listErr != nil {
+		t.Fatalf("ListConfigSorted: %v", listErr)
+	}
+	if len(matches) != maxFiles || matches[0] != "store-test.2" || matches[1] != "store-test.3" {
+		t.Errorf("ListConfigSorted: expected %d newest files: %v", maxFiles, matches)
+	}
+
+	last := prefix + "3"
+	data, readErr := FileRead(last, 100)
+	if readErr != nil {
+		t.Fatalf("FileRead: %v", readErr)
+	}
+	if string(data) != "d" {
+		t.Errorf("FileRead: [%s]: got=[%s] wanted=[d]", last, data)
+	}
+
+	if _, _, infoErr := FileInfo(prefix + "0"); infoErr == nil {
+		t.Errorf("FileInfo: pruned file still exists: %s", prefix+"0")
+	}
+
+	// other paths are not seen by the memory backend
+	if fileExists("lab/store-test.3") {
+		t.Errorf("fileExists: memory file leaked into local filesystem")
+	}
+}
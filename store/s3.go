@@ -1,11 +1,9 @@
 package store
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -234,54 +232,6 @@ func s3fileReader(path string) (io.ReadCloser, error) {
 	return resp.Body, err
 }
 
-func s3fileRead(path string, maxSize int64) ([]byte, error) {
-
-	r, err := s3fileReader(path)
-	if err != nil {
-		return nil, err
-	}
-
-	defer r.Close()
-
-	l := &io.LimitedReader{R: r, N: maxSize}
-
-	buf, readErr := ioutil.ReadAll(r)
-	if readErr != nil {
-		return buf, readErr
-	}
-
-	if l.N < 1 {
-		return buf, fmt.Errorf("s3fileRead: reached max=%d: remaining bytes: %d", maxSize, l.N)
-	}
-
-	return buf, nil
-}
-
-func s3fileFirstLine(path string) (string, error) {
-
-	region, bucket, key := s3parse(path)
-
-	svc := s3client(region)
-	if svc == nil {
-		return "", fmt.Errorf("s3fileFirstLine: missing s3 client")
-	}
-
-	params := &s3.GetObjectInput{
-		Bucket: aws.String(bucket), // Required
-		Key:    aws.String(key),    // Required
-	}
-
-	resp, err := svc.GetObject(params)
-	if err != nil {
-		return "", err
-	}
-
-	r := bufio.NewReader(resp.Body)
-	line, _, readErr := r.ReadLine()
-
-	return string(line[:]), readErr
-}
-
 func s3dirList(path string) (string, []string, error) {
 
 	dirname := filepath.Dir(path)
@@ -0,0 +1,404 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/udhos/equalfile"
+)
+
+// SFTP store: files are kept on a remote server addressed as sftp://user@host[:port]/folder/file
+// The remote path is absolute. Path cleaning might collapse "sftp://" into "sftp:/", both are accepted.
+
+// SFTPConfig holds settings for connecting to SFTP servers.
+type SFTPConfig struct {
+	KeyFile        string        // private key for publickey authentication
+	Password       string        // password authentication
+	KnownHostsFile string        // server host keys - required
+	Timeout        time.Duration // connection timeout
+}
+
+var (
+	sftpLogger  hasPrintf
+	sftpAuth    []ssh.AuthMethod
+	sftpHostKey ssh.HostKeyCallback
+	sftpTimeout time.Duration
+	sftpLock    sync.Mutex
+	sftpClients = map[string]*sftpConn{} // user@host:port => connection
+)
+
+// sftpConn is shared by concurrent operations on the same user@host.
+// The first user dials it outside sftpLock, other users wait for ready.
+// Dropped connections are closed by their last user.
+type sftpConn struct {
+	ready   chan struct{} // closed when dial finishes
+	err     error         // dial error
+	ssh     *ssh.Client
+	sftp    *sftp.Client
+	users   int  // protected by sftpLock
+	dropped bool // protected by sftpLock
+}
+
+func (c *sftpConn) Close() {
+	if c.sftp != nil {
+		c.sftp.Close()
+	}
+	if c.ssh != nil {
+		c.ssh.Close()
+	}
+}
+
+// SFTPInit enables the SFTP store.
+func SFTPInit(logger hasPrintf, cfg SFTPConfig) error {
+
+	if cfg.KnownHostsFile == "" {
+		return fmt.Errorf("SFTPInit: missing known_hosts file")
+	}
+	hostKey, hostKeyErr := knownhosts.New(cfg.KnownHostsFile)
+	if hostKeyErr != nil {
+		return fmt.Errorf("SFTPInit: %v", hostKeyErr)
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		buf, readErr := ioutil.ReadFile(cfg.KeyFile)
+		if readErr != nil {
+			return fmt.Errorf("SFTPInit: %v", readErr)
+		}
+		signer, keyErr := ssh.ParsePrivateKey(buf)
+		if keyErr != nil {
+			return fmt.Errorf("SFTPInit: key '%s': %v", cfg.KeyFile, keyErr)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) < 1 {
+		return fmt.Errorf("SFTPInit: missing key file or password")
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	sftpLock.Lock()
+	for k, c := range sftpClients {
+		delete(sftpClients, k)
+		sftpDropLocked(c)
+	}
+	sftpLogger = logger
+	sftpAuth = auth
+	sftpHostKey = hostKey
+	sftpTimeout = timeout
+	sftpLock.Unlock()
+
+	logger.Printf("sftp store: initialized: known_hosts=%s", cfg.KnownHostsFile)
+
+	return nil
+}
+
+// SFTPPath checks if path is an sftp path.
+func SFTPPath(path string) bool {
+	return strings.HasPrefix(path, "sftp:")
+}
+
+// sftpParse splits path: "sftp://user@host/folder/file" => "user", "host:22", "/folder/file"
+func sftpParse(p string) (string, string, string, error) {
+	s := strings.TrimLeft(strings.TrimPrefix(p, "sftp:"), "/")
+
+	slash := strings.IndexByte(s, '/')
+	if slash < 0 {
+		return "", "", "", fmt.Errorf("sftp: missing remote path: [%s]", p)
+	}
+	authority, remote := s[:slash], s[slash:]
+
+	at := strings.LastIndexByte(authority, '@')
+	if at < 1 {
+		return "", "", "", fmt.Errorf("sftp: missing user: [%s]", p)
+	}
+	user, host := authority[:at], authority[at+1:]
+
+	if _, _, splitErr := net.SplitHostPort(host); splitErr != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+
+	return user, host, remote, nil
+}
+
+func sftpDial(logger hasPrintf, config *ssh.ClientConfig, host string) (*ssh.Client, *sftp.Client, error) {
+	conn, dialErr := net.DialTimeout("tcp", host, config.Timeout)
+	if dialErr != nil {
+		return nil, nil, fmt.Errorf("sftp: %s@%s: %v", config.User, host, dialErr)
+	}
+
+	// timeout also covers ssh handshake: unresponsive servers would hang forever
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+	sshConn, chans, reqs, handshakeErr := ssh.NewClientConn(conn, host, config)
+	if handshakeErr != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("sftp: %s@%s: %v", config.User, host, handshakeErr)
+	}
+	conn.SetDeadline(time.Time{})
+
+	cli := ssh.NewClient(sshConn, chans, reqs)
+
+	client, clientErr := sftp.NewClient(cli)
+	if clientErr != nil {
+		cli.Close()
+		return nil, nil, fmt.Errorf("sftp: %s@%s: %v", config.User, host, clientErr)
+	}
+
+	logger.Printf("sftp store: connected: %s@%s", config.User, host)
+
+	return cli, client, nil
+}
+
+// sftpAcquire gets cached connection for user@host, dialing a new one if needed.
+// The caller must sftpRelease the connection.
+func sftpAcquire(user, host string) (*sftpConn, error) {
+	key := user + "@" + host
+
+	sftpLock.Lock()
+	if sftpAuth == nil {
+		sftpLock.Unlock()
+		return nil, fmt.Errorf("sftp store: uninitialized")
+	}
+	c, found := sftpClients[key]
+	if !found {
+		c = &sftpConn{ready: make(chan struct{})}
+		sftpClients[key] = c
+	}
+	c.users++
+	logger := sftpLogger
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            sftpAuth,
+		HostKeyCallback: sftpHostKey,
+		Timeout:         sftpTimeout,
+	}
+	sftpLock.Unlock()
+
+	if found {
+		<-c.ready
+	} else {
+		// dial outside lock: slow servers must not block other hosts
+		c.ssh, c.sftp, c.err = sftpDial(logger, config, host)
+		if c.err != nil {
+			sftpLock.Lock()
+			if sftpClients[key] == c {
+				delete(sftpClients, key)
+			}
+			sftpLock.Unlock()
+		}
+		close(c.ready)
+	}
+
+	if c.err != nil {
+		sftpRelease(c)
+		return nil, c.err
+	}
+
+	return c, nil
+}
+
+// sftpRelease returns connection acquired by sftpAcquire.
+func sftpRelease(c *sftpConn) {
+	sftpLock.Lock()
+	c.users--
+	last := c.users == 0 && c.dropped
+	sftpLock.Unlock()
+	if last {
+		c.Close()
+	}
+}
+
+// sftpDropLocked keeps connection from being reused, closing it when unused.
+// The caller must hold sftpLock.
+func sftpDropLocked(c *sftpConn) {
+	c.dropped = true
+	if c.users == 0 {
+		c.Close()
+	}
+}
+
+// sftpHold runs op on cached connection for path.
+// Broken connections are dropped, then op is retried once on a new connection.
+// On success, the connection is returned still acquired.
+func sftpHold(p string, op func(c *sftp.Client, remote string) error) (*sftpConn, error) {
+	user, host, remote, parseErr := sftpParse(p)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	for retry := 0; ; retry++ {
+		c, acquireErr := sftpAcquire(user, host)
+		if acquireErr != nil {
+			return nil, acquireErr
+		}
+
+		err := op(c.sftp, remote)
+		if err == nil {
+			return c, nil
+		}
+		if retry > 0 || !sftpBroken(c) {
+			sftpRelease(c)
+			return nil, err
+		}
+
+		sftpLock.Lock()
+		if sftpClients[user+"@"+host] == c {
+			delete(sftpClients, user+"@"+host)
+		}
+		sftpDropLocked(c)
+		sftpLock.Unlock()
+		sftpRelease(c)
+	}
+}
+
+// sftpDo runs op on cached connection for path.
+func sftpDo(p string, op func(c *sftp.Client, remote string) error) error {
+	c, err := sftpHold(p, op)
+	if err != nil {
+		return err
+	}
+	sftpRelease(c)
+	return nil
+}
+
+// sftpBroken checks if connection was lost.
+func sftpBroken(c *sftpConn) bool {
+	_, err := c.sftp.Getwd()
+	return err != nil
+}
+
+// sftpBackend stores files on remote SFTP servers.
+type sftpBackend struct{}
+
+func (sftpBackend) FileExists(p string) bool {
+	return sftpDo(p, func(c *sftp.Client, remote string) error {
+		_, err := c.Stat(remote)
+		return err
+	}) == nil
+}
+
+func (sftpBackend) FileRemove(p string) error {
+	return sftpDo(p, func(c *sftp.Client, remote string) error {
+		return c.Remove(remote)
+	})
+}
+
+func (sftpBackend) FileRename(p1, p2 string) error {
+	_, _, remote2, parseErr := sftpParse(p2)
+	if parseErr != nil {
+		return parseErr
+	}
+	return sftpDo(p1, func(c *sftp.Client, remote1 string) error {
+		if err := c.PosixRename(remote1, remote2); err == nil {
+			return nil
+		}
+		// server without posix-rename extension: plain rename refuses to replace existing file
+		return c.Rename(remote1, remote2)
+	})
+}
+
+// FileReader keeps the connection acquired until the reader is closed.
+func (sftpBackend) FileReader(p string) (io.ReadCloser, error) {
+	var f *sftp.File
+	c, err := sftpHold(p, func(c *sftp.Client, remote string) error {
+		var openErr error
+		f, openErr = c.Open(remote)
+		return openErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{Reader: f, close: func() error {
+		err := f.Close()
+		sftpRelease(c)
+		return err
+	}}, nil
+}
+
+func (sftpBackend) FileWrite(p string, buf []byte, contentType string) error {
+	return sftpDo(p, func(c *sftp.Client, remote string) error {
+		f, createErr := c.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if createErr != nil {
+			return createErr
+		}
+		if _, writeErr := f.Write(buf); writeErr != nil {
+			f.Close()
+			return writeErr
+		}
+		return f.Close()
+	})
+}
+
+func (sftpBackend) FileInfo(p string) (time.Time, int64, error) {
+	var info os.FileInfo
+	err := sftpDo(p, func(c *sftp.Client, remote string) error {
+		var statErr error
+		info, statErr = c.Stat(remote)
+		return statErr
+	})
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return info.ModTime(), info.Size(), nil
+}
+
+func (b sftpBackend) FileCompare(p1, p2 string) (bool, error) {
+	r1, err1 := b.FileReader(p1)
+	if err1 != nil {
+		return false, err1
+	}
+	defer r1.Close()
+
+	r2, err2 := b.FileReader(p2)
+	if err2 != nil {
+		return false, err2
+	}
+	defer r2.Close()
+
+	buf := make([]byte, 100000)
+	cmp := equalfile.New(buf, equalfile.Options{MaxSize: 10000000})
+	return cmp.CompareReader(r1, r2)
+}
+
+func (sftpBackend) DirList(p string) (string, []string, error) {
+	dirname := filepath.Dir(p)
+	var names []string
+	err := sftpDo(p, func(c *sftp.Client, remote string) error {
+		list, readErr := c.ReadDir(path.Dir(remote))
+		if readErr != nil {
+			return readErr
+		}
+		for _, info := range list {
+			names = append(names, info.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return dirname, nil, fmt.Errorf("ListConfig: error reading dir '%s': %v", dirname, err)
+	}
+	return dirname, names, nil
+}
+
+func (sftpBackend) MkDir(p string) error {
+	return sftpDo(p, func(c *sftp.Client, remote string) error {
+		return c.MkdirAll(remote)
+	})
+}
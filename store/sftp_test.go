@@ -0,0 +1,294 @@
+package store
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/udhos/jazigo/temp"
+)
+
+// sftpTestServer is an in-process SFTP server exposing the local filesystem.
+type sftpTestServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+	lock     sync.Mutex
+	conns    []net.Conn
+}
+
+func newSFTPTestServer(t *testing.T, hostKey ssh.Signer) *sftpTestServer {
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() != "lab" || string(pass) != "pass" {
+				return nil, fmt.Errorf("bad password")
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("sftp server: listen: %v", listenErr)
+	}
+
+	s := &sftpTestServer{listener: listener, config: config}
+
+	go func() {
+		for {
+			conn, acceptErr := listener.Accept()
+			if acceptErr != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns = append(s.conns, conn)
+			s.lock.Unlock()
+			go s.handle(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *sftpTestServer) handle(conn net.Conn) {
+	_, chans, reqs, handshakeErr := ssh.NewServerConn(conn, s.config)
+	if handshakeErr != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, acceptErr := newChannel.Accept()
+		if acceptErr != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, serverErr := sftp.NewServer(channel)
+				if serverErr != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				channel.Close()
+			}
+		}()
+	}
+}
+
+// dropConnections simulates lost connections.
+func (s *sftpTestServer) dropConnections() {
+	s.lock.Lock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+	s.lock.Unlock()
+}
+
+func (s *sftpTestServer) Close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func TestSFTPStore(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	_, priv, keyErr := ed25519.GenerateKey(rand.Reader)
+	if keyErr != nil {
+		t.Fatalf("host key: %v", keyErr)
+	}
+	hostKey, signerErr := ssh.NewSignerFromKey(priv)
+	if signerErr != nil {
+		t.Fatalf("host key: %v", signerErr)
+	}
+
+	server := newSFTPTestServer(t, hostKey)
+	defer server.Close()
+	addr := server.listener.Addr().String()
+
+	knownHosts := filepath.Join(repo, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey.PublicKey())
+	if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("known_hosts: %v", err)
+	}
+
+	if err := SFTPInit(logger, SFTPConfig{Password: "pass", KnownHostsFile: knownHosts}); err != nil {
+		t.Fatalf("SFTPInit: %v", err)
+	}
+
+	dir := "sftp://lab@" + addr + filepath.ToSlash(filepath.Join(repo, "remote", "lab1"))
+	if err := MkDir(dir); err != nil {
+		t.Fatalf("MkDir: %v", err)
+	}
+
+	maxFiles := 2
+	prefix := dir + "/store-test."
+	storeBatch(t, prefix, maxFiles, logger)
+
+	// pruned locally on the server side
+	if _, err := ioutil.ReadFile(filepath.Join(repo, "remote", "lab1", "store-test.0")); err == nil {
+		t.Errorf("store-test.0 should have been removed")
+	}
+	if buf, err := ioutil.ReadFile(filepath.Join(repo, "remote", "lab1", "store-test.3")); err != nil || string(buf) != "d" {
+		t.Errorf("store-test.3: content=[%s] error: %v", buf, err)
+	}
+
+	// changes only: identical content keeps last file
+	writeFunc := func(w HasWrite) error {
+		_, err := w.Write([]byte("d"))
+		return err
+	}
+	path, saveErr := SaveNewConfig(prefix, maxFiles, logger, writeFunc, true, "")
+	if saveErr != nil {
+		t.Errorf("SaveNewConfig: %v", saveErr)
+	}
+	if id, _ := ExtractCommitIDFromFilename(path); id != 3 {
+		t.Errorf("SaveNewConfig: unchanged content created new file: %s", path)
+	}
+
+	// lost connection is redialed
+	server.dropConnections()
+	last, findErr := FindLastConfig(prefix, logger)
+	if findErr != nil {
+		t.Fatalf("FindLastConfig after lost connection: %v", findErr)
+	}
+	buf, readErr := FileRead(last, 100)
+	if readErr != nil || string(buf) != "d" {
+		t.Errorf("FileRead: [%s]: content=[%s] error: %v", last, buf, readErr)
+	}
+}
+
+func TestSFTPHostKeyMismatch(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(priv)
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := ssh.NewSignerFromKey(otherPriv)
+
+	server := newSFTPTestServer(t, hostKey)
+	defer server.Close()
+	addr := server.listener.Addr().String()
+
+	knownHosts := filepath.Join(repo, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, otherKey.PublicKey())
+	if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("known_hosts: %v", err)
+	}
+
+	if err := SFTPInit(logger, SFTPConfig{Password: "pass", KnownHostsFile: knownHosts}); err != nil {
+		t.Fatalf("SFTPInit: %v", err)
+	}
+
+	path := "sftp://lab@" + addr + filepath.ToSlash(filepath.Join(repo, "x"))
+	if err := FileWrite(path, []byte("x")); err == nil {
+		t.Errorf("FileWrite: unexpected success with unknown host key")
+	}
+}
+
+func TestSFTPSharedConnection(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	hostKey, _ := ssh.NewSignerFromKey(priv)
+
+	server := newSFTPTestServer(t, hostKey)
+	defer server.Close()
+	addr := server.listener.Addr().String()
+
+	// unresponsive server: accepts, never speaks ssh
+	silent, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatalf("listen: %v", listenErr)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	knownHosts := filepath.Join(repo, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey.PublicKey())
+	if err := ioutil.WriteFile(knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("known_hosts: %v", err)
+	}
+
+	timeout := time.Second
+	if err := SFTPInit(logger, SFTPConfig{Password: "pass", KnownHostsFile: knownHosts, Timeout: timeout}); err != nil {
+		t.Fatalf("SFTPInit: %v", err)
+	}
+
+	// slow dial must not block other hosts
+	slowDone := make(chan struct{})
+	go func() {
+		FileExists("sftp://lab@" + silent.Addr().String() + "/x")
+		close(slowDone)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	begin := time.Now()
+	path := "sftp://lab@" + addr + filepath.ToSlash(filepath.Join(repo, "x"))
+	if err := FileWrite(path, []byte("x")); err != nil {
+		t.Errorf("FileWrite: %v", err)
+	}
+	if elap := time.Since(begin); elap >= timeout {
+		t.Errorf("FileWrite blocked by slow host: elapsed=%v", elap)
+	}
+
+	// dropped connection is closed only by its last user
+	c, acquireErr := sftpAcquire("lab", addr)
+	if acquireErr != nil {
+		t.Fatalf("sftpAcquire: %v", acquireErr)
+	}
+	sftpLock.Lock()
+	delete(sftpClients, "lab@"+addr)
+	sftpDropLocked(c)
+	sftpLock.Unlock()
+	if _, err := c.sftp.Getwd(); err != nil {
+		t.Errorf("dropped connection closed while in use: %v", err)
+	}
+	sftpRelease(c)
+	if _, err := c.sftp.Getwd(); err == nil {
+		t.Errorf("dropped connection not closed by last user")
+	}
+
+	<-slowDone
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -66,13 +65,29 @@ func ExtractCommitIDFromFilename(filename string) (int, error) {
 	return id, nil
 }
 
-func fileFirstLine(path string) (string, error) {
+// fileReader opens file for reading, with transparent decryption and decompression.
+// It also reports whether the file is stored encoded (encrypted or compressed).
+func fileReader(path string) (io.ReadCloser, bool, error) {
+	f, openErr := backendFor(path).FileReader(path)
+	if openErr != nil {
+		return nil, false, openErr
+	}
+	return decodeReader(path, f)
+}
 
-	if s3path(path) {
-		return s3fileFirstLine(path)
+// decodeReader wraps f with decryption and decompression, if needed.
+func decodeReader(path string, f io.ReadCloser) (io.ReadCloser, bool, error) {
+	r, encrypted, decryptErr := decryptReader(f)
+	if decryptErr != nil {
+		return nil, encrypted, fmt.Errorf("%s: %v", path, decryptErr)
 	}
+	d, method, decompressErr := decompressReader(r)
+	return d, encrypted || method != CompressNone, decompressErr
+}
 
-	f, openErr := os.Open(path)
+func fileFirstLine(path string) (string, error) {
+
+	f, _, openErr := fileReader(path)
 	if openErr != nil {
 		return "", openErr
 	}
@@ -162,26 +177,7 @@ func ListConfigSorted(configPathPrefix string, reverse bool, logger hasPrintf) (
 }
 
 func dirList(path string) (string, []string, error) {
-
-	if s3path(path) {
-		return s3dirList(path)
-	}
-
-	dirname := filepath.Dir(path)
-
-	dir, err := os.Open(dirname)
-	if err != nil {
-		return dirname, nil, fmt.Errorf("ListConfig: error opening dir '%s': %v", dirname, err)
-	}
-
-	defer dir.Close()
-
-	names, err2 := dir.Readdirnames(0)
-	if err2 != nil {
-		return dirname, nil, fmt.Errorf("ListConfig: error reading dir '%s': %v", dirname, err2)
-	}
-
-	return dirname, names, nil
+	return backendFor(path).DirList(path)
 }
 
 // ListConfig retrieves files under a path prefix.
@@ -202,8 +198,7 @@ func ListConfig(configPathPrefix string, logger hasPrintf) (string, []string, er
 	// filter prefix
 	matches := names[:0] // slice trick: Filtering without allocating
 	for _, x := range names {
-		lastByte := rune(x[len(x)-1])
-		if unicode.IsDigit(lastByte) && strings.HasPrefix(x, basename) {
+		if strings.HasPrefix(x, basename) && allDigits(x[len(basename):]) {
 			matches = append(matches, x)
 		}
 	}
@@ -211,6 +206,19 @@ func ListConfig(configPathPrefix string, logger hasPrintf) (string, []string, er
 	return dirname, matches, nil
 }
 
+// allDigits checks commit id: "aaa.bbb.1" is not a commit for prefix "aaa."
+func allDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !unicode.IsDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
 // HasWrite is a helper interface for types providing the method Write().
 type HasWrite interface {
 	Write(p []byte) (int, error)
@@ -224,57 +232,33 @@ func getConfigPath(configPathPrefix, id string) string {
 	return fmt.Sprintf("%s%s", configPathPrefix, id)
 }
 
-func fileExists(path string) bool {
-
-	if s3path(path) {
-		return s3fileExists(path)
-	}
-
-	if _, err := os.Stat(path); err == nil {
-		return true
-	}
+// FileExists checks if file exists.
+func FileExists(path string) bool {
+	return fileExists(path)
+}
 
-	return false
+func fileExists(path string) bool {
+	return backendFor(path).FileExists(path)
 }
 
 func fileRemove(path string) error {
-
-	if s3path(path) {
-		return s3fileRemove(path)
-	}
-
-	return os.Remove(path)
+	return backendFor(path).FileRemove(path)
 }
 
 func fileRename(p1, p2 string) error {
-
-	if s3path(p1) {
-		return s3fileRename(p1, p2)
-	}
-
-	return os.Rename(p1, p2)
+	return backendFor(p1).FileRename(p1, p2)
 }
 
-// FileRead reads bytes from file.
+// FileRead reads bytes from file. Encrypted and compressed files are decoded, then maxSize limits the decoded size.
 func FileRead(path string, maxSize int64) ([]byte, error) {
 
-	var r *io.LimitedReader
-
-	if s3path(path) {
-		r1, readErr := s3fileReader(path)
-		if readErr != nil {
-			return nil, readErr
-		}
-		defer r1.Close()
-		r = &io.LimitedReader{R: r1, N: maxSize}
-	} else {
-		f, openErr := os.Open(path)
-		if openErr != nil {
-			return nil, openErr
-		}
-		defer f.Close()
-		r = &io.LimitedReader{R: f, N: maxSize}
+	f, _, openErr := fileReader(path)
+	if openErr != nil {
+		return nil, openErr
 	}
+	defer f.Close()
+
+	r := &io.LimitedReader{R: f, N: maxSize}
 
 	buf, readErr := ioutil.ReadAll(r)
 	if readErr != nil {
@@ -288,44 +272,53 @@ func FileRead(path string, maxSize int64) ([]byte, error) {
 	return buf, nil
 }
 
-func writeFileBuf(path string, buf []byte, contentType string) error {
-
-	if s3path(path) {
-		return s3fileput(path, buf, contentType)
-	}
+// FileWrite replaces the file contents with buf.
+func FileWrite(path string, buf []byte) error {
+	return writeFileBuf(path, buf, "")
+}
 
-	return ioutil.WriteFile(path, buf, 0640)
+func writeFileBuf(path string, buf []byte, contentType string) error {
+	return backendFor(path).FileWrite(path, buf, contentType)
 }
 
+// writeFile writes file compressed as selected by SetCompression, then encrypted if SetEncryptionKey was given a key.
 func writeFile(path string, writeFunc func(HasWrite) error, contentType string) error {
 
-	if s3path(path) {
-		w := &bytes.Buffer{}
+	w := &bytes.Buffer{}
 
-		if err := writeFunc(w); err != nil {
-			return fmt.Errorf("SaveNewConfig: writeFunc error: [%s]: %v", path, err)
-		}
-
-		return s3fileput(path, w.Bytes(), contentType)
+	if err := writeFunc(w); err != nil {
+		return fmt.Errorf("SaveNewConfig: writeFunc error: [%s]: %v", path, err)
 	}
 
-	f, createErr := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0640)
-	if createErr != nil {
-		return fmt.Errorf("SaveNewConfig: error creating file: [%s]: %v", path, createErr)
-	}
+	buf := w.Bytes()
 
-	w := bufio.NewWriter(f)
+	// empty files are kept plain, since log files are created empty and then appended to
+	if len(buf) > 0 {
+		var compressErr error
+		buf, compressErr = compress(getCompression(), buf)
+		if compressErr != nil {
+			return fmt.Errorf("SaveNewConfig: [%s]: %v", path, compressErr)
+		}
 
-	if err := writeFunc(w); err != nil {
-		return fmt.Errorf("SaveNewConfig: writeFunc error: [%s]: %v", path, err)
-	}
+		switch compressedWith(buf) {
+		case CompressGzip:
+			contentType = "application/gzip"
+		case CompressZstd:
+			contentType = "application/zstd"
+		}
 
-	if err := w.Flush(); err != nil {
-		return fmt.Errorf("SaveNewConfig: error flushing file: [%s]: %v", path, err)
+		if k := getEncryptionKey(); k != nil {
+			var encryptErr error
+			buf, encryptErr = encrypt(k, buf)
+			if encryptErr != nil {
+				return fmt.Errorf("SaveNewConfig: [%s]: %v", path, encryptErr)
+			}
+			contentType = "application/octet-stream"
+		}
 	}
 
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("SaveNewConfig: error closing file: [%s]: %v", path, err)
+	if err := writeFileBuf(path, buf, contentType); err != nil {
+		return fmt.Errorf("SaveNewConfig: error writing file: [%s]: %v", path, err)
 	}
 
 	return nil
@@ -333,6 +326,16 @@ func writeFile(path string, writeFunc func(HasWrite) error, contentType string)
 
 // SaveNewConfig saves data to a new file. The function writeFunc must be provided to issue the actual data.
 func SaveNewConfig(configPathPrefix string, maxFiles int, logger hasPrintf, writeFunc func(HasWrite) error, changesOnly bool, contentType string) (string, error) {
+	return SaveNewConfigInfo(configPathPrefix, maxFiles, logger, writeFunc, changesOnly, contentType, CommitInfo{})
+}
+
+// SaveNewConfigInfo saves data to a new file, recording commit info under git store.
+// Git store keeps full history: maxFiles and changesOnly are ignored.
+func SaveNewConfigInfo(configPathPrefix string, maxFiles int, logger hasPrintf, writeFunc func(HasWrite) error, changesOnly bool, contentType string, info CommitInfo) (string, error) {
+
+	if c, isCommitter := backendFor(configPathPrefix).(committer); isCommitter {
+		return c.SaveNewConfig(configPathPrefix, logger, writeFunc, info)
+	}
 
 	// get tmp file
 
@@ -450,37 +453,39 @@ func eraseOldFiles(configPathPrefix string, maxFiles int, logger hasPrintf) {
 
 // FileInfo returns file modification time and size.
 func FileInfo(path string) (time.Time, int64, error) {
+	return backendFor(path).FileInfo(path)
+}
 
-	if s3path(path) {
-		return s3fileInfo(path)
+// fileCompare compares file contents.
+// Encoded files are compared after decryption and decompression.
+func fileCompare(p1, p2 string) (bool, error) {
+	equal, err := backendFor(p1).FileCompare(p1, p2)
+	if err != nil || equal {
+		return equal, err
 	}
 
-	info, statErr := os.Stat(path)
-	if statErr != nil {
-		return time.Time{}, 0, statErr
+	r1, encoded1, err1 := fileReader(p1)
+	if err1 != nil {
+		return false, err1
 	}
+	defer r1.Close()
 
-	return info.ModTime(), info.Size(), nil
-}
-
-func fileCompare(p1, p2 string) (bool, error) {
+	r2, encoded2, err2 := fileReader(p2)
+	if err2 != nil {
+		return false, err2
+	}
+	defer r2.Close()
 
-	if s3path(p1) {
-		maxSize := int64(10000000) // 10M FIXME??
-		return s3fileCompare(p1, p2, maxSize)
+	if !encoded1 && !encoded2 {
+		return false, nil // raw files differ
 	}
 
-	cmp := equalfile.New(nil, equalfile.Options{})
-	return cmp.CompareFile(p1, p2)
+	buf := make([]byte, 100000)
+	cmp := equalfile.New(buf, equalfile.Options{MaxSize: 10000000})
+	return cmp.CompareReader(r1, r2)
 }
 
 // MkDir creates a new directory.
 func MkDir(path string) error {
-
-	if s3path(path) {
-		s3log("store.MkDir: silently refusing to create unneeded dir path on S3: [%s]", path)
-		return nil
-	}
-
-	return os.MkdirAll(path, 0750)
+	return backendFor(path).MkDir(path)
 }
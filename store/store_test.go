@@ -55,6 +55,36 @@ func TestStore1(t *testing.T) {
 	}
 }
 
+func TestListConfigPrefix(t *testing.T) {
+
+	repo := temp.MakeTempRepo()
+	defer temp.CleanupTempRepo()
+
+	logger := &testLogger{t}
+
+	for _, name := range []string{"dev.1", "dev.2", "dev.last", "dev.version.3", "dev.version.last", "dev.10x"} {
+		if err := FileWrite(filepath.Join(repo, name), []byte(name)); err != nil {
+			t.Fatalf("FileWrite: %v", err)
+		}
+	}
+
+	_, matches, err := ListConfigSorted(filepath.Join(repo, "dev."), false, logger)
+	if err != nil {
+		t.Fatalf("ListConfigSorted: %v", err)
+	}
+	if len(matches) != 2 || matches[0] != "dev.1" || matches[1] != "dev.2" {
+		t.Errorf("ListConfigSorted: dev.: %v", matches)
+	}
+
+	_, matches, err = ListConfigSorted(filepath.Join(repo, "dev.version."), false, logger)
+	if err != nil {
+		t.Fatalf("ListConfigSorted: %v", err)
+	}
+	if len(matches) != 1 || matches[0] != "dev.version.3" {
+		t.Errorf("ListConfigSorted: dev.version.: %v", matches)
+	}
+}
+
 func storeBatch(t *testing.T, prefix string, maxFiles int, logger hasPrintf) {
 	if err := storeWrite(t, prefix, "a", fmt.Sprintf("%s0", prefix), maxFiles, logger, ""); err != nil {
 		t.Errorf("TestStore1: %v", err)